@@ -1,7 +1,8 @@
 package asm
 
 import (
-	"fmt"
+	"github.com/crookdc/nand2tetris/diagnostic"
+	"github.com/crookdc/nand2tetris/lexer"
 	"strconv"
 )
 
@@ -52,37 +53,123 @@ var (
 	}
 )
 
+// Assemble translates the Hack assembly in src into machine code.
 func Assemble(src string) ([][16]byte, error) {
-	mem, err := buildMemoryMap(src)
-	if err != nil {
-		return nil, err
+	return AssembleFile("", src)
+}
+
+// AssembleFile works like Assemble but reports errors relative to the named file. Assembly does not stop at the first
+// problem, instead every problem found in src is returned as a diagnostic.List.
+func AssembleFile(file string, src string) ([][16]byte, error) {
+	program, _, err := AssembleDebug(file, src)
+	return program, err
+}
+
+// AssembleDebug works like AssembleFile but also returns the Debug information relating the program to src.
+func AssembleDebug(file string, src string) ([][16]byte, Debug, error) {
+	return Link([]Source{{Name: file, Code: src}}, Options{})
+}
+
+// Source is a named unit of Hack assembly, usually the contents of a single .asm file.
+type Source struct {
+	Name string
+	Code string
+}
+
+// Link assembles several sources into a single program in the order given, such that execution starts at the first
+// instruction of the first source. Labels and variables are shared between the sources, except for those whose names
+// begin with a period which are local to the file that they appear in. Declaring the same label in several files is
+// an error.
+func Link(sources []Source, opts Options) ([][16]byte, Debug, error) {
+	var diagnostics diagnostic.List
+	instructions := make([]instruction, 0)
+	for _, src := range sources {
+		parsed, problems := parse(src.Name, src.Code)
+		diagnostics = append(diagnostics, problems...)
+		instructions = append(instructions, parsed...)
 	}
-	var program [][16]byte
-	lex := NewLexer()
-	lex.Load(src)
-	ps := parser{lexer: lex}
-	for ps.more() {
-		ins, err := ps.next()
-		if err != nil {
-			return nil, err
+	declared := make(map[string]lexer.Position)
+	for _, ins := range instructions {
+		l, ok := ins.(label)
+		if !ok {
+			continue
+		}
+		pos, ok := declared[l.value.Literal]
+		if !ok {
+			declared[l.value.Literal] = l.value.Position
+			continue
 		}
+		if opts.Strict || pos.File != l.value.Position.File {
+			diagnostics.Add(lexer.TokenErrorf(l.value, "label %s is already declared at %s", l.value.Literal, pos))
+		}
+	}
+	if opts.Strict {
+		diagnostics = append(diagnostics, validate(instructions)...)
+	}
+	mem := buildMemoryMap(instructions)
+	var program [][16]byte
+	debug := Debug{
+		Symbols: collectSymbols(instructions, mem),
+		Lines:   make([]lexer.Position, 0),
+	}
+	for _, ins := range instructions {
 		switch v := ins.(type) {
 		case load:
 			bin, err := assembleLoadInstruction(mem, v)
 			if err != nil {
-				return nil, err
+				diagnostics.Add(err)
+				continue
 			}
 			program = append(program, bin)
+			debug.Lines = append(debug.Lines, v.start())
 		case compute:
-			bin, err := assembleComputeInstruction(v)
+			bin, err := assembleComputeInstruction(v, opts.ISA)
 			if err != nil {
-				return nil, err
+				diagnostics.Add(err)
+				continue
 			}
 			program = append(program, bin)
+			debug.Lines = append(debug.Lines, v.start())
 		default:
 		}
 	}
-	return program, nil
+	if opts.Strict && len(program) > romSize {
+		diagnostics.Add(lexer.Errorf(
+			debug.Lines[romSize],
+			"program of %d instructions does not fit in ROM of %d, this is the first instruction outside of it",
+			len(program), romSize,
+		))
+	}
+	if err := diagnostics.Err(); err != nil {
+		return nil, Debug{}, err
+	}
+	if warnings := warnings(diagnostics); len(warnings) > 0 && opts.Warnings != nil {
+		opts.Warnings(warnings)
+	}
+	return program, debug, nil
+}
+
+// parse preprocesses and reads every instruction in src. A malformed instruction does not stop the parser, it is
+// reported and the parser then resumes on the following line.
+func parse(file string, src string) ([]instruction, diagnostic.List) {
+	expanded, origins, diagnostics := preprocess(file, src)
+	instructions := make([]instruction, 0)
+	ps := parser{lexer: LoadedFileLexer(file, expanded)}
+	for ps.more() {
+		ins, err := ps.next()
+		if err != nil {
+			d := diagnostic.From(err)
+			d.Range.Start = relocate(d.Range.Start, origins)
+			d.Range.End = relocate(d.Range.End, origins)
+			diagnostics = append(diagnostics, d)
+			ps.synchronize(err)
+			continue
+		}
+		if ins != nil {
+			instructions = append(instructions, localize(relocateInstruction(ins, origins)))
+		}
+	}
+	return instructions, diagnostics
 }
 
 func wrap(n int) [16]byte {
@@ -101,19 +188,28 @@ func assembleLoadInstruction(mem map[string]int, v load) ([16]byte, error) {
 	} else if v.value.Variant == identifier {
 		bin = mem[v.value.Literal]
 	} else {
-		return [16]byte{}, fmt.Errorf("unexpected load token %+v", v.value)
+		return [16]byte{}, lexer.TokenErrorf(v.value, "unexpected load token '%s'", v.value.Literal)
 	}
 	if err != nil {
-		return [16]byte{}, err
+		return [16]byte{}, lexer.TokenErrorf(v.value, "%w", err)
 	}
 	bin = bin & 0b0111_1111_1111_1111
 	return wrap(bin), nil
 }
 
-func assembleComputeInstruction(v compute) ([16]byte, error) {
+func assembleComputeInstruction(v compute, isa ISA) ([16]byte, error) {
+	set := Standard
 	bin, ok := computations[v.comp]
 	if !ok {
-		return [16]byte{}, fmt.Errorf("unexpected computational segment %s", v.comp)
+		if bin, ok = shifts[v.comp]; ok {
+			set = Extended
+		}
+	}
+	if !ok {
+		return [16]byte{}, lexer.Errorf(v.position, "unexpected computational segment %s", v.comp)
+	}
+	if set == Extended && isa != Extended {
+		return [16]byte{}, lexer.Errorf(v.position, "computation %s requires the extended instruction set", v.comp)
 	}
 	bin = bin << 6
 	if v.dest != nil {
@@ -121,7 +217,7 @@ func assembleComputeInstruction(v compute) ([16]byte, error) {
 		for i := range v.dest.Literal {
 			d, ok := destinations[v.dest.Literal[i]]
 			if !ok {
-				return [16]byte{}, fmt.Errorf("invalid destination %+v", v.dest)
+				return [16]byte{}, lexer.TokenErrorf(*v.dest, "invalid destination %s", v.dest.Literal)
 			}
 			dest = dest | d
 		}
@@ -130,66 +226,59 @@ func assembleComputeInstruction(v compute) ([16]byte, error) {
 	if v.jump != nil {
 		jump, ok := jumps[v.jump.Literal]
 		if !ok {
-			return [16]byte{}, fmt.Errorf("invalid jump %+v", v.jump)
+			return [16]byte{}, lexer.TokenErrorf(*v.jump, "invalid jump %s", v.jump.Literal)
 		}
 		bin = bin | jump
 	}
-	bin = bin | 0b1110_0000_0000_0000
+	bin = bin | set.prefix()<<13
 	return wrap(bin), nil
 }
 
-func buildMemoryMap(src string) (map[string]int, error) {
-	mem := map[string]int{
-		"R0":     0,
-		"R1":     1,
-		"R2":     2,
-		"R3":     3,
-		"R4":     4,
-		"R5":     5,
-		"R6":     6,
-		"R7":     7,
-		"R8":     8,
-		"R9":     9,
-		"R10":    10,
-		"R11":    11,
-		"R12":    12,
-		"R13":    13,
-		"R14":    14,
-		"R15":    15,
-		"SP":     0,
-		"LCL":    1,
-		"ARG":    2,
-		"THIS":   3,
-		"THAT":   4,
-		"SCREEN": 16_384,
-		"KBD":    24_576,
-	}
-	ps := parser{
-		lexer: LoadedLexer(src),
-	}
-	for line := 0; ps.more(); line++ {
-		ins, err := ps.next()
-		if err != nil {
-			return nil, err
-		}
+// predefined are the symbols that every Hack program can reference without declaring them.
+var predefined = map[string]int{
+	"R0":     0,
+	"R1":     1,
+	"R2":     2,
+	"R3":     3,
+	"R4":     4,
+	"R5":     5,
+	"R6":     6,
+	"R7":     7,
+	"R8":     8,
+	"R9":     9,
+	"R10":    10,
+	"R11":    11,
+	"R12":    12,
+	"R13":    13,
+	"R14":    14,
+	"R15":    15,
+	"SP":     0,
+	"LCL":    1,
+	"ARG":    2,
+	"THIS":   3,
+	"THAT":   4,
+	"SCREEN": 16_384,
+	"KBD":    24_576,
+}
+
+func buildMemoryMap(instructions []instruction) map[string]int {
+	mem := make(map[string]int, len(predefined))
+	for k, v := range predefined {
+		mem[k] = v
+	}
+	line := 0
+	for _, ins := range instructions {
 		switch v := ins.(type) {
 		case label:
 			if _, ok := mem[v.value.Literal]; !ok {
 				mem[v.value.Literal] = line
 			}
-			line--
 		default:
+			line++
 		}
 	}
-	ps = parser{
-		lexer: LoadedLexer(src),
-	}
 	cursor := 16
-	for ps.more() {
-		ins, err := ps.next()
-		if err != nil {
-			return nil, err
-		}
+	for _, ins := range instructions {
 		switch v := ins.(type) {
 		case load:
 			if v.value.Variant != identifier {
@@ -203,5 +292,44 @@ func buildMemoryMap(src string) (map[string]int, error) {
 		default:
 		}
 	}
-	return mem, nil
+	return mem
+}
+
+// Symbols holds the addresses that the symbols declared by a program resolve to.
+type Symbols struct {
+	// Labels maps every label to the ROM address of the instruction following it.
+	Labels map[string]int `json:"labels"`
+	// Variables maps every variable to the RAM address allocated to it. Predefined symbols are not included.
+	Variables map[string]int `json:"variables"`
+}
+
+// SymbolsFile returns the symbols declared by the assembly in src, resolved the same way AssembleFile resolves them.
+func SymbolsFile(file string, src string) (Symbols, error) {
+	instructions, diagnostics := parse(file, src)
+	if err := diagnostics.Err(); err != nil {
+		return Symbols{}, err
+	}
+	return collectSymbols(instructions, buildMemoryMap(instructions)), nil
+}
+
+func collectSymbols(instructions []instruction, mem map[string]int) Symbols {
+	syms := Symbols{
+		Labels:    make(map[string]int),
+		Variables: make(map[string]int),
+	}
+	for _, ins := range instructions {
+		if l, ok := ins.(label); ok {
+			syms.Labels[l.value.Literal] = mem[l.value.Literal]
+		}
+	}
+	for name, addr := range mem {
+		if _, ok := predefined[name]; ok {
+			continue
+		}
+		if _, ok := syms.Labels[name]; ok {
+			continue
+		}
+		syms.Variables[name] = addr
+	}
+	return syms
 }
@@ -1,6 +1,12 @@
 package asm
 
-import "testing"
+import (
+	"bytes"
+	"errors"
+	"github.com/crookdc/nand2tetris/diagnostic"
+	"reflect"
+	"testing"
+)
 
 func TestWrap(t *testing.T) {
 	tests := []struct {
@@ -19,3 +25,110 @@ func TestWrap(t *testing.T) {
 		}
 	}
 }
+
+func TestAssembleFile_errors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{
+			src:      "@1\nD=X+1\n",
+			expected: "Main.asm:2:3: unexpected computational segment X+1",
+		},
+		{
+			src:      "@1\n\nD;JMP\nMD=0;JXX\n",
+			expected: "Main.asm:4:6: invalid jump JXX",
+		},
+		{
+			src:      "@-1\n",
+			expected: "Main.asm:1:2: unexpected token for A-instruction '-'",
+		},
+		{
+			src:      "#\n",
+			expected: "Main.asm:1:1: all delegates failed to process character '#'",
+		},
+		{
+			src:      "@2\n#",
+			expected: "Main.asm:2:1: all delegates failed to process character '#'",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			_, err := AssembleFile("Main.asm", test.src)
+			if err == nil {
+				t.Fatal("expected an error but got nil")
+			}
+			if err.Error() != test.expected {
+				t.Errorf("expected %q but got %q", test.expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestAssembleFile_diagnostics(t *testing.T) {
+	src := "@1\nD=X\n(LOOP\n@2\n@#\n0;JXX\nD=M\n"
+	_, err := AssembleFile("Main.asm", src)
+	var list diagnostic.List
+	if !errors.As(err, &list) {
+		t.Fatalf("expected a diagnostic list but got %v", err)
+	}
+	expected := []int{3, 5, 2, 6}
+	if len(list) != len(expected) {
+		t.Fatalf("expected %d diagnostics but got %d: %v", len(expected), len(list), list)
+	}
+	for i, line := range expected {
+		if list[i].Range.Start.Line != line {
+			t.Errorf("expected diagnostic %d on line %d but got %s", i, line, list[i])
+		}
+	}
+}
+
+func TestSymbolsFile(t *testing.T) {
+	src := "@i\nM=0\n(LOOP)\n@i\nM=M+1\n@SCREEN\nD=A\n@LOOP\n0;JMP\n(END)\n@sum\n@R2\n"
+	symbols, err := SymbolsFile("Main.asm", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Symbols{
+		Labels:    map[string]int{"LOOP": 2, "END": 8},
+		Variables: map[string]int{"i": 16, "sum": 17},
+	}
+	if !reflect.DeepEqual(symbols, expected) {
+		t.Errorf("expected %v but got %v", expected, symbols)
+	}
+}
+
+func TestAssembleDebug(t *testing.T) {
+	src := "// sum\n@i\nM=0\n(LOOP)\n  @i\n  MD=M+1\n@LOOP\n0;JMP\n"
+	_, debug, err := AssembleDebug("Main.asm", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteDebug(&buf, debug); err != nil {
+		t.Fatal(err)
+	}
+	debug, err = ReadDebug(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		addr     int
+		expected string
+	}{
+		{addr: 0, expected: "0 (Main.asm:2)"},
+		{addr: 1, expected: "1 (Main.asm:3)"},
+		{addr: 2, expected: "LOOP (Main.asm:5)"},
+		{addr: 3, expected: "LOOP+1 (Main.asm:6)"},
+		{addr: 5, expected: "LOOP+3 (Main.asm:8)"},
+		{addr: 6, expected: "LOOP+4"},
+	}
+	for _, test := range tests {
+		if actual := debug.Describe(test.addr); actual != test.expected {
+			t.Errorf("expected %q but got %q", test.expected, actual)
+		}
+	}
+	if col := debug.Lines[3].Column; col != 3 {
+		t.Errorf("expected instruction at column 3 but got %d", col)
+	}
+}
@@ -0,0 +1,176 @@
+package asm
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/crookdc/nand2tetris/lexer"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Debug relates an assembled program back to the assembly it was assembled from. It is written next to the program by
+// cmd/asm so that the simulator can describe ROM addresses in terms of the source.
+type Debug struct {
+	Symbols
+	// Lines holds the position in the source of the instruction at every ROM address.
+	Lines []lexer.Position `json:"lines"`
+	// Origins holds what the instruction at every ROM address was generated from when the assembly was itself generated,
+	// such as by the VM translator. It is empty for hand-written assembly.
+	Origins []Origin `json:"origins,omitempty"`
+}
+
+// Origin describes the code that an instruction of generated assembly was generated from.
+type Origin struct {
+	Position lexer.Position `json:"position"`
+	// Function is the function that the code belongs to, if any.
+	Function string `json:"function,omitempty"`
+	// Command is the code as it is written in its own language, such as "push constant 7".
+	Command string `json:"command,omitempty"`
+}
+
+func (o Origin) String() string {
+	str := o.Command
+	if o.Function != "" {
+		str = fmt.Sprintf("%s: %s", o.Function, str)
+	}
+	switch {
+	case o.Position.Line == 0:
+		return str
+	case o.Position.File == "":
+		return fmt.Sprintf("%s (line %d)", str, o.Position.Line)
+	default:
+		return fmt.Sprintf("%s (%s:%d)", str, o.Position.File, o.Position.Line)
+	}
+}
+
+// AssembleGenerated assembles generated assembly given as one instruction or label per line. Every line is attributed
+// to the Origin at the same index, which the returned Debug information carries through to the ROM addresses.
+func AssembleGenerated(file string, lines []string, origins []Origin) ([][16]byte, Debug, error) {
+	if len(lines) != len(origins) {
+		return nil, Debug{}, fmt.Errorf("got %d origins for %d lines", len(origins), len(lines))
+	}
+	program, debug, err := AssembleDebug(file, strings.Join(lines, "\n"))
+	if err != nil {
+		return nil, Debug{}, err
+	}
+	debug.Origins = make([]Origin, len(debug.Lines))
+	for addr, pos := range debug.Lines {
+		debug.Origins[addr] = origins[pos.Line-1]
+	}
+	return program, debug, nil
+}
+
+// Label returns the closest label at or before addr along with the distance from it, or false if no label precedes
+// addr. Ties between labels declared at the same address are broken alphabetically.
+func (d Debug) Label(addr int) (string, int, bool) {
+	closest, name := -1, ""
+	for l, a := range d.Labels {
+		if a <= addr && (a > closest || (a == closest && l < name)) {
+			closest, name = a, l
+		}
+	}
+	if closest < 0 {
+		return "", 0, false
+	}
+	return name, addr - closest, true
+}
+
+// Describe formats addr relative to the closest preceding label followed by the source line of the instruction, such
+// as "LOOP+3 (Main.asm:42)". Whichever part is unknown is left out, leaving the bare address if both are.
+func (d Debug) Describe(addr int) string {
+	str := fmt.Sprintf("%d", addr)
+	if name, offset, ok := d.Label(addr); ok && offset == 0 {
+		str = name
+	} else if ok {
+		str = fmt.Sprintf("%s+%d", name, offset)
+	}
+	if addr < 0 || addr >= len(d.Lines) {
+		return str
+	}
+	pos := d.Lines[addr]
+	if pos.File == "" {
+		return fmt.Sprintf("%s (line %d)", str, pos.Line)
+	}
+	return fmt.Sprintf("%s (%s:%d)", str, pos.File, pos.Line)
+}
+
+// Section is a run of consecutive ROM addresses assembled from the same file, from Start up to but excluding End.
+type Section struct {
+	File  string
+	Start int
+	End   int
+}
+
+// Sections splits the program into the Sections assembled from each file, in the order they appear in ROM. A file may
+// contribute several sections when it is included by another.
+func (d Debug) Sections() []Section {
+	sections := make([]Section, 0)
+	for addr, pos := range d.Lines {
+		if n := len(sections); n > 0 && sections[n-1].File == pos.File {
+			sections[n-1].End = addr + 1
+			continue
+		}
+		sections = append(sections, Section{File: pos.File, Start: addr, End: addr + 1})
+	}
+	return sections
+}
+
+// WriteLinkMap writes a human-readable report of d to w, listing the sections of the program followed by the address
+// of every label and variable.
+func WriteLinkMap(w io.Writer, d Debug) error {
+	var sb strings.Builder
+	sb.WriteString("sections:\n")
+	for _, s := range d.Sections() {
+		fmt.Fprintf(&sb, "  %5d-%5d  %s\n", s.Start, s.End-1, s.File)
+	}
+	for _, group := range []struct {
+		title   string
+		symbols map[string]int
+	}{{"labels", d.Labels}, {"variables", d.Variables}} {
+		fmt.Fprintf(&sb, "%s:\n", group.title)
+		names := make([]string, 0, len(group.symbols))
+		for name := range group.symbols {
+			names = append(names, name)
+		}
+		slices.SortFunc(names, func(a, b string) int {
+			if c := group.symbols[a] - group.symbols[b]; c != 0 {
+				return c
+			}
+			return strings.Compare(a, b)
+		})
+		for _, name := range names {
+			fmt.Fprintf(&sb, "  %5d  %s\n", group.symbols[name], name)
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// WriteDebug writes d to w in the JSON format read by ReadDebug.
+func WriteDebug(w io.Writer, d Debug) error {
+	return json.NewEncoder(w).Encode(d)
+}
+
+// WriteDebugFile writes d to the named file, which is created or truncated, like WriteDebug does.
+func WriteDebugFile(filename string, d Debug) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := WriteDebug(f, d); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadDebug reads Debug information written by WriteDebug.
+func ReadDebug(r io.Reader) (Debug, error) {
+	var d Debug
+	if err := json.NewDecoder(r).Decode(&d); err != nil {
+		return Debug{}, fmt.Errorf("invalid debug information: %w", err)
+	}
+	return d, nil
+}
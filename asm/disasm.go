@@ -0,0 +1,109 @@
+package asm
+
+import (
+	"fmt"
+	"github.com/crookdc/nand2tetris/diagnostic"
+	"slices"
+	"strconv"
+)
+
+// mnemonics maps every computation, including the a-bit, to its mnemonic and is the inverse of computations.
+var mnemonics = invert(computations)
+
+// jumpMnemonics maps every jump field to its mnemonic and is the inverse of jumps.
+var jumpMnemonics = invert(jumps)
+
+func invert(m map[string]int) map[int]string {
+	inverted := make(map[int]string, len(m))
+	for k, v := range m {
+		inverted[v] = k
+	}
+	return inverted
+}
+
+// Disassemble translates machine code back into Hack assembly, one instruction or label per line. The labels and
+// variables of symbols, which may be left empty, are restored: labels are declared at their addresses and every symbol
+// replaces the value of the A-instructions that load its address. Where a label and a variable share an address the
+// label is preferred when the following instruction jumps. Instructions that do not encode a valid computation of isa
+// are written as comments and reported as warnings.
+func Disassemble(program []uint16, symbols Symbols, isa ISA) ([]string, diagnostic.List) {
+	labels := names(symbols.Labels)
+	variables := names(symbols.Variables)
+	var warnings diagnostic.List
+	asm := make([]string, 0, len(program))
+	for addr, ins := range program {
+		for _, name := range labels[addr] {
+			asm = append(asm, fmt.Sprintf("(%s)", name))
+		}
+		if ins&0x8000 == 0 {
+			value := int(ins)
+			jumps := addr+1 < len(program) && program[addr+1]&0x8000 != 0 && program[addr+1]&0b111 != 0
+			switch {
+			case jumps && len(labels[value]) > 0:
+				asm = append(asm, "@"+labels[value][0])
+			case len(variables[value]) > 0:
+				asm = append(asm, "@"+variables[value][0])
+			case len(labels[value]) > 0:
+				asm = append(asm, "@"+labels[value][0])
+			default:
+				asm = append(asm, "@"+strconv.Itoa(value))
+			}
+			continue
+		}
+		str, ok := disassembleComputeInstruction(ins, isa)
+		if !ok {
+			warnings = append(warnings, diagnostic.Warningf(
+				diagnostic.Range{},
+				"instruction %016b at ROM address %d does not encode a valid computation", ins, addr,
+			))
+			asm = append(asm, fmt.Sprintf("// invalid instruction %016b", ins))
+			continue
+		}
+		asm = append(asm, str)
+	}
+	for _, name := range labels[len(program)] {
+		asm = append(asm, fmt.Sprintf("(%s)", name))
+	}
+	return asm, warnings
+}
+
+func disassembleComputeInstruction(ins uint16, isa ISA) (string, bool) {
+	table := mnemonics
+	switch {
+	case int(ins>>13) == Standard.prefix():
+	case int(ins>>13) == Extended.prefix() && isa == Extended:
+		table = shiftMnemonics
+	default:
+		return "", false
+	}
+	comp, ok := table[int(ins>>6)&0b111_1111]
+	if !ok {
+		return "", false
+	}
+	var dest string
+	for _, d := range []uint8{'A', 'M', 'D'} {
+		if int(ins>>3)&destinations[d] != 0 {
+			dest += string(d)
+		}
+	}
+	str := comp
+	if dest != "" {
+		str = dest + "=" + str
+	}
+	if jump := int(ins) & 0b111; jump != 0 {
+		str += ";" + jumpMnemonics[jump]
+	}
+	return str, true
+}
+
+// names maps every address in symbols to the names declared at it, sorted alphabetically.
+func names(symbols map[string]int) map[int][]string {
+	addresses := make(map[int][]string)
+	for name, addr := range symbols {
+		addresses[addr] = append(addresses[addr], name)
+	}
+	for _, n := range addresses {
+		slices.Sort(n)
+	}
+	return addresses
+}
@@ -0,0 +1,67 @@
+package asm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	src := []string{"@i", "M=1", "(LOOP)", "@i", "D=M", "@100", "D=D-A", "@END", "D;JGT", "@i", "AM=M+1", "@LOOP", "0;JMP", "(END)", "@END", "0;JMP", "(EXIT)"}
+	program, debug, err := AssembleDebug("", strings.Join(src, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := make([]uint16, len(program))
+	for i, ins := range program {
+		for _, bit := range ins {
+			words[i] = words[i]<<1 | uint16(bit)
+		}
+	}
+	tests := []struct {
+		name     string
+		symbols  Symbols
+		expected []string
+	}{
+		{
+			name:     "symbols",
+			symbols:  debug.Symbols,
+			expected: src,
+		},
+		{
+			name:     "addresses",
+			expected: []string{"@16", "M=1", "@16", "D=M", "@100", "D=D-A", "@12", "D;JGT", "@16", "AM=M+1", "@2", "0;JMP", "@12", "0;JMP"},
+		},
+		{
+			// The variable shares address 2 with LOOP but is only used when the next instruction does not jump.
+			name:     "ambiguous",
+			symbols:  Symbols{Labels: map[string]int{"LOOP": 2}, Variables: map[string]int{"x": 2}},
+			expected: []string{"@16", "M=1", "(LOOP)", "@16", "D=M", "@100", "D=D-A", "@12", "D;JGT", "@16", "AM=M+1", "@LOOP", "0;JMP", "@12", "0;JMP"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, warnings := Disassemble(words, test.symbols, Standard)
+			if len(warnings) != 0 {
+				t.Fatalf("unexpected warnings %v", warnings)
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("expected %v but got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDisassemble_invalid(t *testing.T) {
+	actual, warnings := Disassemble([]uint16{0b1110_1010_1000_0111, 0b1111_1111_1100_0000, 0b1000_1100_0001_0000}, Symbols{}, Standard)
+	expected := []string{"0;JMP", "// invalid instruction 1111111111000000", "// invalid instruction 1000110000010000"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+	if len(warnings) != 2 || warnings.Err() != nil {
+		t.Fatalf("expected 2 warnings but got %v", warnings)
+	}
+	if msg := warnings[0].Message; msg != "instruction 1111111111000000 at ROM address 1 does not encode a valid computation" {
+		t.Errorf("unexpected warning %q", msg)
+	}
+}
@@ -0,0 +1,48 @@
+package asm
+
+import "fmt"
+
+// ISA names an instruction set that programs can be assembled for.
+type ISA string
+
+const (
+	// Standard is the instruction set of the Hack computer as specified by nand2tetris.
+	Standard ISA = "standard"
+	// Extended adds the shift instructions supported by the nand2tetris CPU emulator. They are encoded like
+	// computations except that bit 14 is cleared, in which case the seven comp bits select a shift of A, D or M by a
+	// single bit instead of an ALU operation.
+	Extended ISA = "extended"
+)
+
+// ParseISA returns the ISA with the given name, an empty name being the Standard ISA.
+func ParseISA(name string) (ISA, error) {
+	switch ISA(name) {
+	case "", Standard:
+		return Standard, nil
+	case Extended:
+		return Extended, nil
+	default:
+		return "", fmt.Errorf("unsupported instruction set: %s", name)
+	}
+}
+
+// prefix returns the three most significant bits of a compute instruction of the ISA.
+func (isa ISA) prefix() int {
+	if isa == Extended {
+		return 0b101
+	}
+	return 0b111
+}
+
+// shifts maps every shift of the Extended ISA, including the a-bit, to its comp bits. Right shifts are arithmetic.
+var shifts = map[string]int{
+	"A<<": 0b0100000,
+	"D<<": 0b0110000,
+	"M<<": 0b1100000,
+	"A>>": 0b0000000,
+	"D>>": 0b0010000,
+	"M>>": 0b1000000,
+}
+
+// shiftMnemonics is the inverse of shifts.
+var shiftMnemonics = invert(shifts)
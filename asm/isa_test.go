@@ -0,0 +1,64 @@
+package asm
+
+import (
+	"github.com/crookdc/nand2tetris/hackfile"
+	"reflect"
+	"testing"
+)
+
+func TestLink_extended(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected uint16
+	}{
+		{src: "A=A<<", expected: 0b101_0100000_100_000},
+		{src: "D=D<<", expected: 0b101_0110000_010_000},
+		{src: "M=M<<", expected: 0b101_1100000_001_000},
+		{src: "A=A>>", expected: 0b101_0000000_100_000},
+		{src: "D=D>>", expected: 0b101_0010000_010_000},
+		{src: "AM=M>>;JNE", expected: 0b101_1000000_101_101},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			program, _, err := Link([]Source{{Name: "Main.asm", Code: test.src}}, Options{ISA: Extended})
+			if err != nil {
+				t.Fatal(err)
+			}
+			words := hackfile.Words(program)
+			if !reflect.DeepEqual(words, []uint16{test.expected}) {
+				t.Errorf("expected %016b but got %016b", test.expected, words)
+			}
+			lines, warnings := Disassemble(words, Symbols{}, Extended)
+			if len(warnings) != 0 || !reflect.DeepEqual(lines, []string{test.src}) {
+				t.Errorf("expected %s to disassemble back to itself but got %v (%v)", test.src, lines, warnings)
+			}
+			_, _, err = Link([]Source{{Name: "Main.asm", Code: test.src}}, Options{})
+			if err == nil {
+				t.Errorf("expected %s to be rejected by the standard instruction set", test.src)
+			}
+		})
+	}
+}
+
+func TestLink_standard(t *testing.T) {
+	_, _, err := Link([]Source{{Name: "Main.asm", Code: "@2\nD=D<<\n"}}, Options{ISA: Standard})
+	expected := "Main.asm:2:3: computation D<< requires the extended instruction set"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q but got %v", expected, err)
+	}
+	lines, warnings := Disassemble([]uint16{0b101_0110000_010_000}, Symbols{}, Standard)
+	if len(warnings) != 1 || !reflect.DeepEqual(lines, []string{"// invalid instruction 1010110000010000"}) {
+		t.Errorf("expected the shift to be invalid in the standard instruction set but got %v", lines)
+	}
+}
+
+func TestParseISA(t *testing.T) {
+	for name, expected := range map[string]ISA{"": Standard, "standard": Standard, "extended": Extended} {
+		if isa, err := ParseISA(name); err != nil || isa != expected {
+			t.Errorf("expected %q to parse as %s but got %s, %v", name, expected, isa, err)
+		}
+	}
+	if _, err := ParseISA("x86"); err == nil {
+		t.Error("expected an unknown instruction set to be rejected")
+	}
+}
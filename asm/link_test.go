@@ -0,0 +1,94 @@
+package asm
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLink(t *testing.T) {
+	main := "@.i\nM=1\n@Math.double\n0;JMP\n(.loop)\n@.loop\n0;JMP\n"
+	math := "(Math.double)\n@.i\nM=M+1\n@.loop\n0;JMP\n(.loop)\n@.loop\n0;JMP\n"
+	program, debug, err := Link([]Source{{Name: "Main.asm", Code: main}, {Name: "lib/Math.asm", Code: math}}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := Assemble("@Main$.i\nM=1\n@Math.double\n0;JMP\n(Main$.loop)\n@Main$.loop\n0;JMP\n" +
+		"(Math.double)\n@Math$.i\nM=M+1\n@Math$.loop\n0;JMP\n(Math$.loop)\n@Math$.loop\n0;JMP\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(program, expected) {
+		t.Errorf("expected %v but got %v", expected, program)
+	}
+	sections := []Section{{File: "Main.asm", Start: 0, End: 6}, {File: "lib/Math.asm", Start: 6, End: 12}}
+	if !reflect.DeepEqual(debug.Sections(), sections) {
+		t.Errorf("expected sections %v but got %v", sections, debug.Sections())
+	}
+	var buf bytes.Buffer
+	if err := WriteLinkMap(&buf, debug); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"      0-    5  Main.asm", "      6-   11  lib/Math.asm", "      4  Main$.loop", "     16  Main$.i"} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("expected link map to contain %q\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestLink_duplicates(t *testing.T) {
+	_, _, err := Link([]Source{{Name: "Main.asm", Code: "(START)\n@START\n"}, {Name: "Other.asm", Code: "@1\n(START)\n"}}, Options{})
+	if err == nil {
+		t.Fatal("expected an error but got nil")
+	}
+	expected := "Other.asm:2:2: label START is already declared at Main.asm:1:2"
+	if err.Error() != expected {
+		t.Errorf("expected %q but got %q", expected, err.Error())
+	}
+}
+
+func TestAssembleFile_include(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Main.asm":       ".include \"lib/macros.asm\"\n@2\nD=A\nDOUBLE\n(.end)\nGOTO .end\n",
+		"lib/macros.asm": ".macro DOUBLE\nD=D+A\n.endm\n.include \"other.asm\"\n",
+		"lib/other.asm":  "@SP // the stack pointer\n",
+		"Loop.asm":       ".include Loop.asm\n",
+	}
+	for name, src := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	main := filepath.Join(dir, "Main.asm")
+	program, debug, err := AssembleDebug(main, files["Main.asm"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := Assemble("@SP\n@2\nD=A\nD=D+A\n(END)\n@END\n0;JMP\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(program, expected) {
+		t.Errorf("expected %v but got %v", expected, program)
+	}
+	if file := debug.Lines[0].File; file != filepath.Join(dir, "lib", "other.asm") {
+		t.Errorf("expected the first instruction to originate from other.asm but got %s", file)
+	}
+	if _, ok := debug.Labels["Main$.end"]; !ok {
+		t.Errorf("expected local label Main$.end but got %v", debug.Labels)
+	}
+	loop := filepath.Join(dir, "Loop.asm")
+	if _, err := AssembleFile(loop, files["Loop.asm"]); err == nil || !strings.HasSuffix(err.Error(), "Loop.asm includes itself") {
+		t.Errorf("expected an include cycle to be reported but got %v", err)
+	}
+	if _, err := AssembleFile(main, ".include missing.asm\n"); err == nil || !strings.Contains(err.Error(), "missing.asm") {
+		t.Errorf("expected a missing include to be reported but got %v", err)
+	}
+}
@@ -0,0 +1,432 @@
+package asm
+
+import (
+	"fmt"
+	"github.com/crookdc/nand2tetris/diagnostic"
+	"github.com/crookdc/nand2tetris/lexer"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxExpansionDepth limits how deeply macros may expand other macros, which catches macros that expand themselves.
+const maxExpansionDepth = 32
+
+var (
+	// pseudo are the built-in pseudo-instructions, which expand to standard instructions. Their names cannot be used for
+	// macros.
+	pseudo = map[string]func(args []string) ([]string, error){
+		"PUSH": func(args []string) ([]string, error) {
+			if len(args) != 1 || args[0] != "D" {
+				return nil, fmt.Errorf("PUSH expects the single operand D")
+			}
+			return []string{"@SP", "AM=M+1", "A=A-1", "M=D"}, nil
+		},
+		"POP": func(args []string) ([]string, error) {
+			if len(args) != 1 || args[0] != "D" {
+				return nil, fmt.Errorf("POP expects the single operand D")
+			}
+			return []string{"@SP", "AM=M-1", "D=M"}, nil
+		},
+		"GOTO": func(args []string) ([]string, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("GOTO expects a single label")
+			}
+			return []string{"@" + args[0], "0;JMP"}, nil
+		},
+	}
+	// loadPseudo and storePseudo match the memory pseudo-instructions, such as D=M[addr] and M[addr]=D, with whitespace removed.
+	loadPseudo  = regexp.MustCompile(`^([AMD]+)=M\[([^\]]+)]$`)
+	storePseudo = regexp.MustCompile(`^M\[([^\]]+)]=D$`)
+	// declaration matches a label declaration and captures its name.
+	declaration = regexp.MustCompile(`^\s*\(\s*([^)\s]+)\s*\)`)
+)
+
+type macro struct {
+	name string
+	// position is where the definition of the macro begins.
+	position lexer.Position
+	params   []string
+	body     []string
+	// labels are the labels declared in the body, which are made unique for every expansion.
+	labels []string
+}
+
+// lineOrigin is where a line of preprocessed source comes from, which is the start of the code on the line of the source
+// that produced it. Lines copied verbatim keep their columns while generated lines are attributed to that start.
+type lineOrigin struct {
+	position lexer.Position
+	verbatim bool
+}
+
+// preprocessor expands the directives, macros and pseudo-instructions of a source into standard Hack assembly while
+// recording the origin of every line it produces. The directives are:
+//
+//	.equ NAME value        defines a numeric constant, value being an integer or a previously defined constant
+//	.define NAME text      replaces every later occurrence of the symbol NAME by text
+//	.macro NAME [params]   starts the definition of a macro, whose body ends at .endm
+//	.include "file"        processes the named file, relative to the including file, in place of the directive
+//
+// The operands of a directive are separated by spaces or commas. A macro is expanded by writing its name followed by one
+// argument per parameter, separated in the same way. Every label declared in the body of a macro is renamed such that
+// each expansion declares its own.
+type preprocessor struct {
+	defines     map[string]string
+	macros      map[string]*macro
+	expansions  int
+	lines       []string
+	origins     []lineOrigin
+	diagnostics diagnostic.List
+	// defining is the macro whose body is currently being read, if any.
+	defining *macro
+	// changed is set once any line is produced that is not a verbatim copy of the source.
+	changed bool
+	// including holds the files currently being processed, the outermost first.
+	including []string
+}
+
+// preprocess expands src, returning the expanded source along with the origin of each of its lines. The origins are nil
+// if src uses no preprocessor features, in which case src is returned as is.
+func preprocess(file string, src string) (string, []lineOrigin, diagnostic.List) {
+	pp := preprocessor{
+		defines: make(map[string]string),
+		macros:  make(map[string]*macro),
+	}
+	pp.source(file, src)
+	if pp.defining != nil {
+		pp.diagnostics.Add(lexer.Errorf(pp.defining.position, "macro %s is missing .endm", pp.defining.name))
+	}
+	if !pp.changed {
+		return src, nil, pp.diagnostics
+	}
+	return strings.Join(pp.lines, "\n"), pp.origins, pp.diagnostics
+}
+
+func (pp *preprocessor) source(file string, src string) {
+	pp.including = append(pp.including, file)
+	offset := 0
+	for i, line := range strings.Split(src, "\n") {
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		pp.line(line, lexer.Position{File: file, Line: i + 1, Column: indent + 1, Offset: offset + indent})
+		offset += len(line) + 1
+	}
+	pp.including = pp.including[:len(pp.including)-1]
+}
+
+// line processes a single line of the source whose code begins at pos.
+func (pp *preprocessor) line(line string, pos lexer.Position) {
+	code := strip(line)
+	if pp.defining != nil {
+		switch {
+		case code == ".endm":
+			pp.defining = nil
+		case strings.HasPrefix(code, ".macro"):
+			pp.diagnostics.Add(lexer.Errorf(pos, "macro definitions cannot be nested"))
+		default:
+			pp.defining.body = append(pp.defining.body, line)
+			if m := declaration.FindStringSubmatch(code); m != nil {
+				pp.defining.labels = append(pp.defining.labels, m[1])
+			}
+		}
+		pp.changed = true
+		return
+	}
+	if strings.HasPrefix(code, ".") {
+		if err := pp.directive(code, pos); err != nil {
+			pp.diagnostics.Add(err)
+		}
+		pp.changed = true
+		return
+	}
+	if err := pp.expand(line, pos, 0); err != nil {
+		pp.diagnostics.Add(err)
+		pp.changed = true
+	}
+}
+
+func (pp *preprocessor) directive(code string, pos lexer.Position) error {
+	fields := strings.Fields(strings.ReplaceAll(code, ",", " "))
+	switch fields[0] {
+	case ".equ":
+		if len(fields) != 3 {
+			return lexer.Errorf(pos, "expected .equ NAME value")
+		}
+		if err := pp.declare(fields[1], pos); err != nil {
+			return err
+		}
+		value, err := pp.constant(fields[2])
+		if err != nil {
+			return lexer.Errorf(pos, "%w", err)
+		}
+		pp.defines[fields[1]] = strconv.Itoa(value)
+	case ".define":
+		if len(fields) < 2 {
+			return lexer.Errorf(pos, "expected .define NAME text")
+		}
+		if err := pp.declare(fields[1], pos); err != nil {
+			return err
+		}
+		_, text, _ := strings.Cut(strings.TrimSpace(strings.TrimPrefix(code, ".define")), fields[1])
+		pp.defines[fields[1]] = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), ","))
+	case ".macro":
+		if len(fields) < 2 {
+			return lexer.Errorf(pos, "expected .macro NAME [params]")
+		}
+		name := fields[1]
+		// The body is read even if the macro is invalid such that it is not mistaken for code.
+		pp.defining = &macro{name: name, position: pos, params: fields[2:]}
+		if _, ok := pseudo[name]; ok {
+			return lexer.Errorf(pos, "macro %s redefines a pseudo-instruction", name)
+		}
+		if _, ok := pp.macros[name]; ok {
+			return lexer.Errorf(pos, "macro %s is already defined", name)
+		}
+		pp.macros[name] = pp.defining
+	case ".endm":
+		return lexer.Errorf(pos, ".endm outside of a macro definition")
+	case ".include":
+		if len(fields) != 2 {
+			return lexer.Errorf(pos, "expected .include \"file\"")
+		}
+		file := filepath.Join(filepath.Dir(pos.File), strings.Trim(fields[1], `"`))
+		if slices.Contains(pp.including, file) {
+			return lexer.Errorf(pos, "%s includes itself", file)
+		}
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return lexer.Errorf(pos, "%w", err)
+		}
+		pp.source(file, string(src))
+	default:
+		return lexer.Errorf(pos, "unknown directive %s", fields[0])
+	}
+	return nil
+}
+
+// declare checks that name is a valid symbol which is not already defined.
+func (pp *preprocessor) declare(name string, pos lexer.Position) error {
+	if !symbol(name) {
+		return lexer.Errorf(pos, "invalid symbol %s", name)
+	}
+	if _, ok := pp.defines[name]; ok {
+		return lexer.Errorf(pos, "%s is already defined", name)
+	}
+	if _, ok := predefined[name]; ok {
+		return lexer.Errorf(pos, "%s redefines a predefined symbol", name)
+	}
+	return nil
+}
+
+// constant evaluates the value of an .equ directive.
+func (pp *preprocessor) constant(value string) (int, error) {
+	if v, ok := pp.defines[value]; ok {
+		value = v
+	}
+	if v, ok := predefined[value]; ok {
+		return v, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 || n > 0x7FFF {
+		return 0, fmt.Errorf("invalid constant %s, expected an integer between 0 and 32767", value)
+	}
+	return n, nil
+}
+
+// expand substitutes the defines in line and expands it if it is a macro or pseudo-instruction, appending the result.
+func (pp *preprocessor) expand(line string, pos lexer.Position, depth int) error {
+	substituted := substitute(line, pp.defines)
+	code := strip(substituted)
+	fields := strings.Fields(strings.ReplaceAll(code, ",", " "))
+	if len(fields) == 0 {
+		pp.emit(line, pos, depth == 0)
+		return nil
+	}
+	if depth > maxExpansionDepth {
+		return lexer.Errorf(pos, "macro expansion exceeds a depth of %d, is a macro expanding itself?", maxExpansionDepth)
+	}
+	if m, ok := pp.macros[fields[0]]; ok {
+		return pp.invoke(m, fields[1:], pos, depth)
+	}
+	var lines []string
+	compact := strings.Join(strings.Fields(code), "")
+	if fn, ok := pseudo[fields[0]]; ok {
+		var err error
+		if lines, err = fn(fields[1:]); err != nil {
+			return lexer.Errorf(pos, "%w", err)
+		}
+	} else if m := loadPseudo.FindStringSubmatch(compact); m != nil {
+		lines = []string{"@" + m[2], m[1] + "=M"}
+	} else if m := storePseudo.FindStringSubmatch(compact); m != nil {
+		lines = []string{"@" + m[1], "M=D"}
+	} else {
+		pp.emit(substituted, pos, depth == 0 && substituted == line)
+		return nil
+	}
+	for _, l := range lines {
+		pp.emit(l, pos, false)
+	}
+	return nil
+}
+
+func (pp *preprocessor) invoke(m *macro, args []string, pos lexer.Position, depth int) error {
+	if len(args) != len(m.params) {
+		return lexer.Errorf(pos, "macro %s expects %d arguments but got %d", m.name, len(m.params), len(args))
+	}
+	pp.expansions++
+	replacements := make(map[string]string, len(m.params)+len(m.labels))
+	for _, l := range m.labels {
+		replacements[l] = fmt.Sprintf("%s$%s.%d", l, m.name, pp.expansions)
+	}
+	for i, p := range m.params {
+		replacements[p] = args[i]
+	}
+	for _, line := range m.body {
+		if err := pp.expand(substitute(line, replacements), pos, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pp *preprocessor) emit(line string, pos lexer.Position, verbatim bool) {
+	if !verbatim {
+		pp.changed = true
+	}
+	pp.lines = append(pp.lines, line)
+	pp.origins = append(pp.origins, lineOrigin{position: pos, verbatim: verbatim})
+}
+
+// strip removes any comment and surrounding whitespace from line.
+func strip(line string) string {
+	if i := strings.Index(line, "//"); i >= 0 {
+		line = line[:i]
+	}
+	return strings.TrimSpace(line)
+}
+
+func identifierStart(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c == '.' || c == '$' || c == ':'
+}
+
+func identifierPart(c byte) bool {
+	return identifierStart(c) || (c >= '0' && c <= '9')
+}
+
+// symbol reports whether name is a valid symbol, that is an identifier as read by the lexer.
+func symbol(name string) bool {
+	if name == "" || !identifierStart(name[0]) {
+		return false
+	}
+	for i := range len(name) {
+		if !identifierPart(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// substitute replaces every identifier in line that appears in replacements, leaving comments untouched.
+func substitute(line string, replacements map[string]string) string {
+	if len(replacements) == 0 {
+		return line
+	}
+	var sb strings.Builder
+	for i := 0; i < len(line); {
+		if strings.HasPrefix(line[i:], "//") {
+			sb.WriteString(line[i:])
+			break
+		}
+		if !identifierStart(line[i]) {
+			sb.WriteByte(line[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(line) && identifierPart(line[j]) {
+			j++
+		}
+		if r, ok := replacements[line[i:j]]; ok {
+			sb.WriteString(r)
+		} else {
+			sb.WriteString(line[i:j])
+		}
+		i = j
+	}
+	return sb.String()
+}
+
+// relocate maps pos, which is a position in preprocessed source, back to the source it was preprocessed from.
+func relocate(pos lexer.Position, origins []lineOrigin) lexer.Position {
+	if origins == nil || pos.Line < 1 || pos.Line > len(origins) {
+		return pos
+	}
+	o := origins[pos.Line-1]
+	if !o.verbatim {
+		return o.position
+	}
+	relocated := o.position
+	relocated.Column = pos.Column
+	relocated.Offset = o.position.Offset - o.position.Column + pos.Column
+	return relocated
+}
+
+// relocateInstruction maps the positions of ins from preprocessed source back to the source.
+func relocateInstruction(ins instruction, origins []lineOrigin) instruction {
+	if origins == nil {
+		return ins
+	}
+	switch v := ins.(type) {
+	case load:
+		line := v.value.Position.Line
+		v.value.Position = relocate(v.value.Position, origins)
+		if line >= 1 && line <= len(origins) && !origins[line-1].verbatim {
+			// Generated instructions begin at their origin, the value follows the @ that start expects before it.
+			v.value.Position.Column++
+			v.value.Position.Offset++
+		}
+		return v
+	case label:
+		v.value.Position = relocate(v.value.Position, origins)
+		return v
+	case compute:
+		if v.dest != nil {
+			dest := *v.dest
+			dest.Position = relocate(dest.Position, origins)
+			v.dest = &dest
+		}
+		if v.jump != nil {
+			jump := *v.jump
+			jump.Position = relocate(jump.Position, origins)
+			v.jump = &jump
+		}
+		v.position = relocate(v.position, origins)
+		return v
+	default:
+		return ins
+	}
+}
+
+// localize qualifies the labels and variables of ins that are local to the file they appear in, which are those whose
+// names begin with a period, by the name of that file.
+func localize(ins instruction) instruction {
+	qualify := func(tok lexer.Token[variant]) lexer.Token[variant] {
+		if tok.Variant == identifier && strings.HasPrefix(tok.Literal, ".") {
+			file := filepath.Base(tok.Position.File)
+			tok.Literal = strings.TrimSuffix(file, filepath.Ext(file)) + "$" + tok.Literal
+		}
+		return tok
+	}
+	switch v := ins.(type) {
+	case load:
+		v.value = qualify(v.value)
+		return v
+	case label:
+		v.value = qualify(v.value)
+		return v
+	default:
+		return ins
+	}
+}
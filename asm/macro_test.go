@@ -0,0 +1,180 @@
+package asm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAssembleFile_macros(t *testing.T) {
+	src := `.equ SIZE 10
+.equ LAST SIZE
+.define COUNTER, R13
+.define INC M=M+1
+
+.macro ZERO addr
+    @addr
+    M=0
+.endm
+
+// Counts target down from n to zero.
+.macro COUNTDOWN n, target
+    @n
+    D=A
+    M[target]=D
+(LOOP)
+    @target
+    M=M-1
+    D=M[target]
+    @LOOP
+    D;JGT
+.endm
+
+    ZERO COUNTER
+    COUNTDOWN LAST, COUNTER
+    COUNTDOWN 3 x
+    PUSH D
+    @COUNTER
+    INC
+    POP D
+(END)
+    GOTO END
+`
+	expected := `@R13
+M=0
+@10
+D=A
+@R13
+M=D
+(LOOP.1)
+@R13
+M=M-1
+@R13
+D=M
+@LOOP.1
+D;JGT
+@3
+D=A
+@x
+M=D
+(LOOP.2)
+@x
+M=M-1
+@x
+D=M
+@LOOP.2
+D;JGT
+@SP
+AM=M+1
+A=A-1
+M=D
+@R13
+M=M+1
+@SP
+AM=M-1
+D=M
+(END)
+@END
+0;JMP
+`
+	actual, debug, err := AssembleDebug("Main.asm", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err := Assemble(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, program) {
+		t.Fatalf("expected %v but got %v", program, actual)
+	}
+	labels := map[string]int{"LOOP$COUNTDOWN.2": 6, "LOOP$COUNTDOWN.3": 16, "END": 31}
+	if !reflect.DeepEqual(debug.Labels, labels) {
+		t.Errorf("expected labels %v but got %v", labels, debug.Labels)
+	}
+	// Expanded instructions are attributed to the line that expanded them.
+	for addr, line := range map[int]int{0: 24, 5: 25, 23: 27, 26: 28, 27: 29, 30: 30, 31: 32} {
+		if debug.Lines[addr].Line != line {
+			t.Errorf("expected ROM address %d to originate from line %d but got %s", addr, line, debug.Lines[addr])
+		}
+	}
+}
+
+func TestAssembleFile_macroErrors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{
+			src:      ".org 100\n",
+			expected: "Main.asm:1:1: unknown directive .org",
+		},
+		{
+			src:      ".macro TWICE a b\n@a\n@b\n.endm\n  TWICE 1\n",
+			expected: "Main.asm:5:3: macro TWICE expects 2 arguments but got 1",
+		},
+		{
+			src:      ".macro BAD\nD=X\n.endm\n@1\nBAD\n",
+			expected: "Main.asm:5:1: unexpected computational segment X",
+		},
+		{
+			src:      ".macro LOOP\nLOOP\n.endm\nLOOP\n",
+			expected: "Main.asm:4:1: macro expansion exceeds a depth of 32, is a macro expanding itself?",
+		},
+		{
+			src:      "@1\n  .macro OPEN\n@1\n",
+			expected: "Main.asm:2:3: macro OPEN is missing .endm",
+		},
+		{
+			src:      ".endm\n",
+			expected: "Main.asm:1:1: .endm outside of a macro definition",
+		},
+		{
+			src:      ".macro PUSH x\n.endm\n",
+			expected: "Main.asm:1:1: macro PUSH redefines a pseudo-instruction",
+		},
+		{
+			src:      "@1\n  PUSH A\n",
+			expected: "Main.asm:2:3: PUSH expects the single operand D",
+		},
+		{
+			src:      ".equ SCREEN 1\n",
+			expected: "Main.asm:1:1: SCREEN redefines a predefined symbol",
+		},
+		{
+			src:      ".equ N 40000\n",
+			expected: "Main.asm:1:1: invalid constant 40000, expected an integer between 0 and 32767",
+		},
+		{
+			src:      ".equ N 1\n.define N 2\n",
+			expected: "Main.asm:2:1: N is already defined",
+		},
+		{
+			src:      ".equ N 1\n  @N\n  D=X+N\n",
+			expected: "Main.asm:3:3: unexpected computational segment X+1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			_, err := AssembleFile("Main.asm", test.src)
+			if err == nil {
+				t.Fatal("expected an error but got nil")
+			}
+			if err.Error() != test.expected {
+				t.Errorf("expected %q but got %q", test.expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	replacements := map[string]string{"N": "10", "ptr": "R13"}
+	actual := substitute("@ptr // N ptr", replacements)
+	if actual != "@R13 // N ptr" {
+		t.Errorf("expected comments to be left untouched but got %q", actual)
+	}
+	actual = substitute("D=M;JGT N2 N", replacements)
+	if !strings.HasSuffix(actual, "N2 10") {
+		t.Errorf("expected only whole symbols to be replaced but got %q", actual)
+	}
+}
@@ -20,6 +20,8 @@ var (
 		')':  rparen,
 		'=':  equals,
 		'!':  bang,
+		'<':  less,
+		'>':  greater,
 	}
 	keywords = map[string]variant{
 		"JGT": jgt,
@@ -40,6 +42,8 @@ const (
 	or
 	equals
 	bang
+	less
+	greater
 	identifier
 	integer
 	lparen
@@ -58,6 +62,30 @@ const (
 
 type variant int
 
+func (v variant) String() string {
+	switch v {
+	case identifier:
+		return "identifier"
+	case integer:
+		return "integer"
+	case linefeed:
+		return "end of line"
+	case comment:
+		return "comment"
+	}
+	for c, symbol := range symbols {
+		if symbol == v {
+			return fmt.Sprintf("'%c'", c)
+		}
+	}
+	for keyword, kw := range keywords {
+		if kw == v {
+			return keyword
+		}
+	}
+	return fmt.Sprintf("variant(%d)", int(v))
+}
+
 func NewLexer() *lexer.Lexer[variant] {
 	return lexer.NewLexer[variant](
 		lexer.Params[variant]{
@@ -88,6 +116,13 @@ func LoadedLexer(src string) *lexer.Lexer[variant] {
 	return lex
 }
 
+// LoadedFileLexer works like LoadedLexer but attributes every token to the named file.
+func LoadedFileLexer(file string, src string) *lexer.Lexer[variant] {
+	lex := NewLexer()
+	lex.LoadFile(file, src)
+	return lex
+}
+
 type instruction interface {
 	Literal() string
 }
@@ -100,10 +135,28 @@ func (l load) Literal() string {
 	return fmt.Sprintf("@%s", l.value.Literal)
 }
 
+// start returns where the instruction begins in the source, which is the @ preceding its value.
+func (l load) start() lexer.Position {
+	pos := l.value.Position
+	pos.Column--
+	pos.Offset--
+	return pos
+}
+
 type compute struct {
 	dest *lexer.Token[variant]
 	comp string
 	jump *lexer.Token[variant]
+	// position is where the computational segment begins in the source.
+	position lexer.Position
+}
+
+// start returns where the instruction begins in the source, which is its destination if it has one.
+func (c compute) start() lexer.Position {
+	if c.dest != nil {
+		return c.dest.Position
+	}
+	return c.position
 }
 
 func (c compute) Literal() string {
@@ -128,6 +181,8 @@ func (l label) Literal() string {
 
 type parser struct {
 	lexer *lexer.Lexer[variant]
+	// line is the line on which the instruction currently being parsed begins.
+	line int
 }
 
 func (p *parser) more() bool {
@@ -135,9 +190,11 @@ func (p *parser) more() bool {
 }
 
 func (p *parser) next() (instruction, error) {
+	p.line = p.lexer.Position().Line
 	if err := p.seek(p.clear); err != nil {
 		return nil, err
 	}
+	p.line = p.lexer.Position().Line
 	tok, err := p.lexer.Peek()
 	if errors.Is(err, io.EOF) {
 		return nil, nil
@@ -145,6 +202,7 @@ func (p *parser) next() (instruction, error) {
 	if err != nil {
 		return nil, err
 	}
+	p.line = tok.Position.Line
 	switch tok.Variant {
 	case at:
 		return p.a()
@@ -164,7 +222,7 @@ func (p *parser) a() (load, error) {
 		return load{}, err
 	}
 	if tok.Variant != integer && tok.Variant != identifier {
-		return load{}, fmt.Errorf("unexpected token for A-instruction '%v'", tok)
+		return load{}, lexer.TokenErrorf(tok, "unexpected token for A-instruction %s", describe(tok))
 	}
 	if err := p.seek(p.clear); err != nil {
 		return load{}, err
@@ -195,21 +253,20 @@ func (p *parser) c() (comp compute, err error) {
 		return compute{}, err
 	}
 	next, err := p.lexer.Peek()
-	if err != nil {
+	if err != nil && !errors.Is(err, io.EOF) {
 		return compute{}, err
 	}
-	if next.Variant == equals {
+	if err == nil && next.Variant == equals {
 		_, _ = p.want(equals)
-		comp.dest = &lexer.Token[variant]{
-			Variant: tok.Variant,
-			Literal: tok.Literal,
-		}
+		dest := tok
+		comp.dest = &dest
 		// Fetch the next token for parsing the compute field
 		tok, err = p.lexer.Next()
 		if err != nil {
 			return compute{}, err
 		}
 	}
+	comp.position = tok.Position
 	for tok.Variant != semicolon && tok.Variant != linefeed {
 		comp.comp += tok.Literal
 		tok, err = p.lexer.Next()
@@ -225,10 +282,7 @@ func (p *parser) c() (comp compute, err error) {
 		if err != nil {
 			return compute{}, err
 		}
-		comp.jump = &lexer.Token[variant]{
-			Variant: jmp.Variant,
-			Literal: jmp.Literal,
-		}
+		comp.jump = &jmp
 		if err := p.seek(p.clear); err != nil {
 			return compute{}, err
 		}
@@ -260,6 +314,21 @@ func (p *parser) seek(fn func(*lexer.Token[variant]) bool) error {
 	return nil
 }
 
+// synchronize skips the remainder of the line on which the current instruction began, or the line on which err occurred
+// if that comes later, unless the parser has already moved past it, so that parsing can resume after a malformed
+// instruction.
+func (p *parser) synchronize(err error) {
+	line := p.line
+	var lerr *lexer.Error
+	if errors.As(err, &lerr) {
+		line = max(line, lerr.Position.Line)
+	}
+	if p.lexer.Position().Line > line {
+		return
+	}
+	_ = p.lexer.Seek(lexer.Equals[variant]('\n'))
+}
+
 func (p *parser) clear(tok *lexer.Token[variant]) bool {
 	return tok.Variant == linefeed || tok.Variant == comment
 }
@@ -273,7 +342,15 @@ func (p *parser) want(v variant) (lexer.Token[variant], error) {
 		return lexer.Token[variant]{}, err
 	}
 	if tok.Variant != v {
-		return lexer.Token[variant]{}, fmt.Errorf("expected '%v' token but found '%v'", v, tok.Variant)
+		return lexer.Token[variant]{}, lexer.TokenErrorf(tok, "expected %s but found %s", v, describe(tok))
 	}
 	return tok, nil
 }
+
+// describe returns a human-readable description of tok for use in error messages.
+func describe(tok lexer.Token[variant]) string {
+	if tok.Variant == linefeed {
+		return tok.Variant.String()
+	}
+	return fmt.Sprintf("'%s'", tok.Literal)
+}
@@ -15,8 +15,9 @@ func TestParser_next(t *testing.T) {
 			src: "@17\n",
 			res: []instruction{
 				load{value: lexer.Token[variant]{
-					Variant: integer,
-					Literal: "17",
+					Variant:  integer,
+					Literal:  "17",
+					Position: lexer.Position{Line: 1, Column: 2, Offset: 1},
 				}},
 			},
 		},
@@ -25,11 +26,13 @@ func TestParser_next(t *testing.T) {
 			res: []instruction{
 				compute{
 					dest: &lexer.Token[variant]{
-						Variant: identifier,
-						Literal: "A",
+						Variant:  identifier,
+						Literal:  "A",
+						Position: lexer.Position{Line: 1, Column: 1, Offset: 0},
 					},
-					comp: "D+1",
-					jump: nil,
+					comp:     "D+1",
+					jump:     nil,
+					position: lexer.Position{Line: 1, Column: 3, Offset: 2},
 				},
 			},
 		},
@@ -40,9 +43,11 @@ func TestParser_next(t *testing.T) {
 					dest: nil,
 					comp: "A",
 					jump: &lexer.Token[variant]{
-						Variant: jgt,
-						Literal: "JGT",
+						Variant:  jgt,
+						Literal:  "JGT",
+						Position: lexer.Position{Line: 1, Column: 3, Offset: 2},
 					},
+					position: lexer.Position{Line: 1, Column: 1, Offset: 0},
 				},
 			},
 		},
@@ -51,28 +56,34 @@ func TestParser_next(t *testing.T) {
 			res: []instruction{
 				load{
 					value: lexer.Token[variant]{
-						Variant: identifier,
-						Literal: "i",
+						Variant:  identifier,
+						Literal:  "i",
+						Position: lexer.Position{Line: 1, Column: 2, Offset: 1},
 					},
 				},
 				compute{
 					dest: &lexer.Token[variant]{
-						Variant: identifier,
-						Literal: "D",
+						Variant:  identifier,
+						Literal:  "D",
+						Position: lexer.Position{Line: 2, Column: 1, Offset: 3},
 					},
-					comp: "A",
-					jump: nil,
+					comp:     "A",
+					jump:     nil,
+					position: lexer.Position{Line: 2, Column: 3, Offset: 5},
 				},
 				compute{
 					dest: &lexer.Token[variant]{
-						Variant: identifier,
-						Literal: "D",
+						Variant:  identifier,
+						Literal:  "D",
+						Position: lexer.Position{Line: 3, Column: 1, Offset: 7},
 					},
 					comp: "D+1",
 					jump: &lexer.Token[variant]{
-						Variant: jne,
-						Literal: "JNE",
+						Variant:  jne,
+						Literal:  "JNE",
+						Position: lexer.Position{Line: 3, Column: 7, Offset: 13},
 					},
+					position: lexer.Position{Line: 3, Column: 3, Offset: 9},
 				},
 			},
 		},
@@ -81,37 +92,44 @@ func TestParser_next(t *testing.T) {
 			res: []instruction{
 				label{
 					value: lexer.Token[variant]{
-						Variant: identifier,
-						Literal: "loop",
+						Variant:  identifier,
+						Literal:  "loop",
+						Position: lexer.Position{Line: 1, Column: 2, Offset: 1},
 					},
 				},
 				load{
 					value: lexer.Token[variant]{
-						Variant: integer,
-						Literal: "1234",
+						Variant:  integer,
+						Literal:  "1234",
+						Position: lexer.Position{Line: 2, Column: 2, Offset: 8},
 					},
 				},
 				compute{
 					dest: &lexer.Token[variant]{
-						Variant: identifier,
-						Literal: "D",
+						Variant:  identifier,
+						Literal:  "D",
+						Position: lexer.Position{Line: 3, Column: 1, Offset: 13},
 					},
-					comp: "A+1",
-					jump: nil,
+					comp:     "A+1",
+					jump:     nil,
+					position: lexer.Position{Line: 3, Column: 3, Offset: 15},
 				},
 				load{
 					value: lexer.Token[variant]{
-						Variant: identifier,
-						Literal: "loop",
+						Variant:  identifier,
+						Literal:  "loop",
+						Position: lexer.Position{Line: 4, Column: 2, Offset: 20},
 					},
 				},
 				compute{
 					dest: nil,
 					comp: "0",
 					jump: &lexer.Token[variant]{
-						Variant: jmp,
-						Literal: "JMP",
+						Variant:  jmp,
+						Literal:  "JMP",
+						Position: lexer.Position{Line: 5, Column: 3, Offset: 27},
 					},
+					position: lexer.Position{Line: 5, Column: 1, Offset: 25},
 				},
 			},
 		},
@@ -120,14 +138,16 @@ func TestParser_next(t *testing.T) {
 			res: []instruction{
 				label{
 					value: lexer.Token[variant]{
-						Variant: identifier,
-						Literal: "loop",
+						Variant:  identifier,
+						Literal:  "loop",
+						Position: lexer.Position{Line: 2, Column: 2, Offset: 36},
 					},
 				},
 				load{
 					value: lexer.Token[variant]{
-						Variant: integer,
-						Literal: "1234",
+						Variant:  integer,
+						Literal:  "1234",
+						Position: lexer.Position{Line: 3, Column: 2, Offset: 43},
 					},
 				},
 			},
@@ -138,7 +158,7 @@ func TestParser_next(t *testing.T) {
 		ins, _ := ps.next()
 		for i := 0; ins != nil; i++ {
 			if !reflect.DeepEqual(test.res[i], ins) {
-				t.Errorf("expected %+v but got %+v", test.res[i].Literal(), ins.Literal())
+				t.Errorf("expected %+v but got %+v", test.res[i], ins)
 			}
 			ins, _ = ps.next()
 		}
@@ -0,0 +1,114 @@
+package asm
+
+import (
+	"fmt"
+	"github.com/crookdc/nand2tetris/diagnostic"
+	"github.com/crookdc/nand2tetris/lexer"
+	"strconv"
+)
+
+// romSize is the number of instructions that fit in the ROM of the Hack computer.
+const romSize = 32768
+
+// Options controls how sources are assembled.
+type Options struct {
+	// Strict rejects programs that are accepted by default but most likely wrong: labels declared more than once or
+	// shadowing a predefined symbol, constants that do not fit in an A-instruction, destinations not written in the
+	// standard order and programs that do not fit in ROM. Variables that are only used once, which are often misspelled
+	// references to other symbols, are reported as warnings.
+	Strict bool
+	// ISA is the instruction set that the program is assembled for, the Standard ISA if left empty.
+	ISA ISA
+	// Warnings is called with the warnings found in a program that assembles successfully, if there are any.
+	Warnings func(diagnostic.List)
+}
+
+// canonical maps every set of destination bits to the way it is written in the Hack specification.
+var canonical = map[int]string{
+	0b001: "M",
+	0b010: "D",
+	0b011: "MD",
+	0b100: "A",
+	0b101: "AM",
+	0b110: "AD",
+	0b111: "AMD",
+}
+
+// validate performs the checks of strict mode that concern individual instructions.
+func validate(instructions []instruction) diagnostic.List {
+	var diagnostics diagnostic.List
+	labels := make(map[string]bool)
+	for _, ins := range instructions {
+		if l, ok := ins.(label); ok {
+			labels[l.value.Literal] = true
+		}
+	}
+	uses := make(map[string][]lexer.Token[variant])
+	for _, ins := range instructions {
+		switch v := ins.(type) {
+		case label:
+			if _, ok := predefined[v.value.Literal]; ok {
+				diagnostics.Add(lexer.TokenErrorf(v.value, "label %s shadows a predefined symbol", v.value.Literal))
+			}
+		case load:
+			switch v.value.Variant {
+			case integer:
+				if n, err := strconv.Atoi(v.value.Literal); err == nil && n > 0x7FFF {
+					diagnostics.Add(lexer.TokenErrorf(v.value, "constant %s does not fit in an A-instruction", v.value.Literal))
+				}
+			case identifier:
+				uses[v.value.Literal] = append(uses[v.value.Literal], v.value)
+			}
+		case compute:
+			if d := destination(v); d != nil {
+				diagnostics = append(diagnostics, *d)
+			}
+		}
+	}
+	for _, ins := range instructions {
+		// Walking the instructions rather than the map keeps the warnings in source order.
+		v, ok := ins.(load)
+		if !ok || v.value.Variant != identifier || len(uses[v.value.Literal]) != 1 || labels[v.value.Literal] {
+			continue
+		}
+		if _, ok := predefined[v.value.Literal]; ok {
+			continue
+		}
+		diagnostics = append(diagnostics, diagnostic.Warningf(
+			diagnostic.Range{Start: v.value.Position, End: v.value.End()},
+			"variable %s is only used once", v.value.Literal,
+		).WithHint("a variable that is never read back is often a misspelled reference to another symbol"))
+	}
+	return diagnostics
+}
+
+// destination reports a destination that is not written the way the Hack specification writes it.
+func destination(v compute) *diagnostic.Diagnostic {
+	if v.dest == nil {
+		return nil
+	}
+	bits := 0
+	for _, c := range []byte(v.dest.Literal) {
+		bits |= destinations[c]
+	}
+	expected, ok := canonical[bits]
+	if !ok || expected == v.dest.Literal {
+		return nil
+	}
+	d := diagnostic.Errorf(
+		diagnostic.Range{Start: v.dest.Position, End: v.dest.End()},
+		"non-standard destination %s", v.dest.Literal,
+	).WithHint(fmt.Sprintf("write %s=%s", expected, v.comp))
+	return &d
+}
+
+// warnings returns the diagnostics of l that are warnings.
+func warnings(l diagnostic.List) diagnostic.List {
+	var filtered diagnostic.List
+	for _, d := range l {
+		if d.Severity == diagnostic.Warning {
+			filtered = append(filtered, d)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,71 @@
+package asm
+
+import (
+	"errors"
+	"github.com/crookdc/nand2tetris/diagnostic"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLink_strict(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected []string
+	}{
+		{
+			src:      "(LOOP)\n@LOOP\n0;JMP\n(LOOP)\n",
+			expected: []string{"Main.asm:4:2: label LOOP is already declared at Main.asm:1:2"},
+		},
+		{
+			src:      "@40000\nD=A\n@32767\n",
+			expected: []string{"Main.asm:1:2: constant 40000 does not fit in an A-instruction"},
+		},
+		{
+			src:      "(SCREEN)\n@SCREEN\n0;JMP\n",
+			expected: []string{"Main.asm:1:2: label SCREEN shadows a predefined symbol"},
+		},
+		{
+			src:      "@1\nDM=A\nAMD=A\nMA=1\n",
+			expected: []string{"Main.asm:2:1: non-standard destination DM", "Main.asm:4:1: non-standard destination MA"},
+		},
+		{
+			src:      strings.Repeat("@1\n", romSize) + "@2\n",
+			expected: []string{"Main.asm:32769:1: program of 32769 instructions does not fit in ROM of 32768, this is the first instruction outside of it"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.expected[0], func(t *testing.T) {
+			_, _, err := Link([]Source{{Name: "Main.asm", Code: test.src}}, Options{Strict: true})
+			var list diagnostic.List
+			if !errors.As(err, &list) {
+				t.Fatalf("expected a diagnostic list but got %v", err)
+			}
+			actual := make([]string, len(list))
+			for i, d := range list {
+				actual[i] = d.Error()
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("expected %q but got %q", test.expected, actual)
+			}
+			if _, _, err := Link([]Source{{Name: "Main.asm", Code: test.src}}, Options{}); err != nil {
+				t.Errorf("expected the program to assemble without strict mode but got %v", err)
+			}
+		})
+	}
+}
+
+func TestLink_warnings(t *testing.T) {
+	src := "@counter\nM=0\n(LOOP)\n@counter\nM=M+1\n@countr\nD=M\n@LOOP\nD;JGT\n@R0\n"
+	var warnings diagnostic.List
+	_, _, err := Link([]Source{{Name: "Main.asm", Code: src}}, Options{
+		Strict:   true,
+		Warnings: func(l diagnostic.List) { warnings = l },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || warnings[0].Error() != "Main.asm:6:2: variable countr is only used once" {
+		t.Errorf("expected a single warning about countr but got %v", warnings)
+	}
+}
@@ -2,34 +2,156 @@ package main
 
 import (
 	"flag"
-	"fmt"
 	"github.com/crookdc/nand2tetris/asm"
+	"github.com/crookdc/nand2tetris/diagnostic"
+	"github.com/crookdc/nand2tetris/hackfile"
 	"log"
 	"os"
+	"strings"
 )
 
+// files collects the values of a flag that may be given several times.
+type files []string
+
+func (f *files) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *files) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
 var (
-	source = flag.String("source", "", "a file containing Hack assembly code")
+	sources     files
+	disassemble = flag.Bool("d", false, "disassemble the machine code in -source, restoring the symbols in -symbols if given")
+	output      = flag.String("o", "", "a file to write the program to instead of standard output")
+	format      = flag.String("format", "", "format of the program, one of text, be, le or ihex, guessed from -o if omitted")
+	diagnostics = flag.String("diagnostics", "text", "format of reported problems, either text or json")
+	symbols     = flag.String("symbols", "", "path of a file to write the symbols and source lines of the program to, or to read them from when disassembling")
+	linkMap     = flag.String("map", "", "path of a file to write a human-readable link map of the program to")
+	strict      = flag.Bool("strict", true, "reject duplicate labels, out of range constants and other likely mistakes, and warn about variables used once")
+	isa         = flag.String("isa", "standard", "instruction set to assemble for, either standard or extended which adds the shifts A<<, D<<, M<<, A>>, D>> and M>>")
 )
 
 func main() {
+	flag.Var(&sources, "source", "a file containing Hack assembly code, or machine code when disassembling. Several files are linked into one program in the order given")
 	flag.Parse()
-	if *source == "" {
+	if len(sources) == 0 {
 		log.Fatal("no source file provided")
 	}
-	src, err := os.ReadFile(*source)
+	set, err := asm.ParseISA(*isa)
 	if err != nil {
 		log.Fatal(err)
 	}
-	program, err := asm.Assemble(string(src))
+	if *disassemble {
+		if len(sources) > 1 {
+			log.Fatal("only a single source can be disassembled")
+		}
+		disassembleFile(sources[0], set)
+		return
+	}
+	units := make([]asm.Source, len(sources))
+	for i, source := range sources {
+		src, err := os.ReadFile(source)
+		if err != nil {
+			log.Fatal(err)
+		}
+		units[i] = asm.Source{Name: source, Code: string(src)}
+	}
+	program, debug, err := asm.Link(units, asm.Options{
+		Strict: *strict,
+		ISA:    set,
+		Warnings: func(warnings diagnostic.List) {
+			if err := diagnostic.Write(os.Stderr, diagnostic.Format(*diagnostics), warnings); err != nil {
+				log.Fatal(err)
+			}
+		},
+	})
+	if err != nil {
+		diagnostic.Fatal(diagnostic.Format(*diagnostics), err)
+	}
+	if *symbols != "" {
+		if err := asm.WriteDebugFile(*symbols, debug); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *linkMap != "" {
+		var sb strings.Builder
+		if err := asm.WriteLinkMap(&sb, debug); err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(*linkMap, []byte(sb.String()), 0666); err != nil {
+			log.Fatal(err)
+		}
+	}
+	f := hackfile.Format(*format)
+	if f == "" {
+		f = hackfile.FormatOf(*output)
+	}
+	if *output == "" {
+		if err := hackfile.Write(os.Stdout, f, hackfile.Words(program)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := writeProgram(*output, f, hackfile.Words(program)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func writeProgram(filename string, format hackfile.Format, program []uint16) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := hackfile.Write(f, format, program); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func disassembleFile(filename string, set asm.ISA) {
+	f := hackfile.Format(*format)
+	if f == "" {
+		f = hackfile.FormatOf(filename)
+	}
+	file, err := os.Open(filename)
 	if err != nil {
 		log.Fatal(err)
 	}
-	for _, ins := range program {
-		var mc string
-		for i := range 16 {
-			mc += fmt.Sprintf("%v", ins[i])
+	program, err := hackfile.Read(filename, file, f)
+	_ = file.Close()
+	if err != nil {
+		diagnostic.Fatal(diagnostic.Format(*diagnostics), err)
+	}
+	var syms asm.Symbols
+	if *symbols != "" {
+		file, err := os.Open(*symbols)
+		if err != nil {
+			log.Fatal(err)
+		}
+		debug, err := asm.ReadDebug(file)
+		_ = file.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		syms = debug.Symbols
+	}
+	lines, warnings := asm.Disassemble(program, syms, set)
+	if len(warnings) > 0 {
+		if err := diagnostic.Write(os.Stderr, diagnostic.Format(*diagnostics), warnings); err != nil {
+			log.Fatal(err)
 		}
-		fmt.Println(mc)
+	}
+	out := []byte(strings.Join(lines, "\n") + "\n")
+	if *output == "" {
+		_, err = os.Stdout.Write(out)
+	} else {
+		err = os.WriteFile(*output, out, 0666)
+	}
+	if err != nil {
+		log.Fatal(err)
 	}
 }
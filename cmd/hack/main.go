@@ -1,37 +1,213 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"github.com/crookdc/nand2tetris/asm"
+	"github.com/crookdc/nand2tetris/diagnostic"
+	"github.com/crookdc/nand2tetris/hackfile"
 	"github.com/crookdc/nand2tetris/simulator"
 	"github.com/crookdc/nand2tetris/simulator/sdl"
 	"log"
 	"os"
+	"os/signal"
 )
 
 var (
-	rom = flag.String("rom", "", "path to file containing program that should be loaded into ROM")
+	rom     = flag.String("rom", "", "path to file containing program that should be loaded into ROM, not needed with -snapshot")
+	format  = flag.String("format", "", "format of the rom file, one of text, be, le or ihex, guessed from its extension if omitted")
+	debug   = flag.Bool("debug", false, "run the program in an interactive debugger reading commands from stdin")
+	source  = flag.String("asm", "", "path to the assembly source of the program, used by the debugger to resolve symbols")
+	symbols = flag.String("symbols", "", "path to the symbols file written by the assembler, used in place of -asm")
+	isa     = flag.String("isa", "standard", "instruction set to execute the program as, either standard or extended which adds shifts")
+	clock   = flag.Int("clock", simulator.DefaultClockRate, "number of instructions to execute per second, or 0 to run as fast as possible")
+	trace   = flag.String("trace", "", "path of a file to write a trace of every executed instruction to until the simulator is interrupted")
+	traceAs = flag.String("trace-format", "text", "format of the trace, either text or binary")
+	profile = flag.String("profile", "", "path of a file to write a flat and a call graph profile to when the simulator is interrupted, using -symbols or -asm to name functions")
+	restore = flag.String("snapshot", "", "path of a snapshot to restore the machine from at startup, replacing the ROM, RAM, registers and instruction set")
+	save    = flag.String("save", "hack.snapshot", "path of the file that a snapshot is saved to when F5 is pressed")
+	history = flag.Int("history", 1_000_000, "number of instructions that the debugger can step back over")
 )
 
 func main() {
 	flag.Parse()
-	if *rom == "" {
+	if *rom == "" && *restore == "" {
 		log.Fatal("mandatory rom flag not present")
 	}
-	program, err := parseProgram(*rom)
+	set, err := asm.ParseISA(*isa)
 	if err != nil {
 		log.Fatal(err)
 	}
-	s := simulator.New(simulator.Parameters{
-		Screen:   simulator.Must(sdl.NewScreen()),
-		Keyboard: sdl.NewKeyboard(),
-		ROM:      program,
+	var program []uint16
+	if *rom != "" {
+		program, err = parseProgram(*rom)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	var tracers simulator.Tracers
+	var writer *simulator.TraceWriter
+	if *trace != "" {
+		f, err := os.Create(*trace)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer closeFile(f)
+		if writer, err = simulator.NewTraceWriter(f, simulator.TraceFormat(*traceAs)); err != nil {
+			log.Fatal(err)
+		}
+		tracers = append(tracers, writer)
+	}
+	var profiler *simulator.Profiler
+	if *profile != "" {
+		profiler = simulator.NewProfiler(symbolTable(set))
+		tracers = append(tracers, profiler)
+	}
+	keyboard := sdl.NewKeyboard()
+	params := simulator.Parameters{
+		Screen:    simulator.Must(sdl.NewScreen()),
+		Keyboard:  keyboard,
+		ROM:       program,
+		ISA:       set,
+		ClockRate: *clock,
+	}
+	if len(tracers) > 0 {
+		params.Tracer = tracers
+	}
+	if *debug {
+		params.History = *history
+	}
+	s := simulator.New(params)
+	if *restore != "" {
+		if err := restoreSnapshot(s, *restore); err != nil {
+			log.Fatal(err)
+		}
+	}
+	keyboard.OnSnapshot(func() {
+		if err := saveSnapshot(s, *save); err != nil {
+			log.Printf("saving snapshot: %v", err)
+			return
+		}
+		log.Printf("saved snapshot of cycle %d to %s", s.Cycles(), *save)
 	})
-	if err := s.Run(); err != nil {
+	if *debug {
+		if err := debugger(s, set).Run(); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		// Tracing and profiling end when the simulator is interrupted, after which their results are written.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err := s.RunContext(ctx)
+		stop()
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Fatal(err)
+		}
+	}
+	if writer != nil {
+		if err := writer.Flush(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if profiler != nil {
+		if err := writeProfile(*profile, profiler); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func writeProfile(filename string, profiler *simulator.Profiler) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := profiler.WriteFlat(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if _, err := f.WriteString("\n"); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := profiler.WriteCallGraph(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func restoreSnapshot(s *simulator.Simulator, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer closeFile(f)
+	if err := s.Restore(f); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+func saveSnapshot(s *simulator.Simulator, filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := s.Save(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func closeFile(f *os.File) {
+	if err := f.Close(); err != nil {
 		log.Fatal(err)
 	}
 }
 
+func debugger(s *simulator.Simulator, set asm.ISA) *simulator.Debugger {
+	debug := symbolTable(set)
+	return simulator.NewDebugger(simulator.DebuggerParameters{
+		Simulator: s,
+		Labels:    debug.Labels,
+		Variables: debug.Variables,
+		Lines:     debug.Lines,
+		Origins:   debug.Origins,
+		Input:     os.Stdin,
+		Output:    os.Stdout,
+	})
+}
+
+// symbolTable reads the debug information of the program from -symbols or by assembling -asm, returning empty debug
+// information if neither is given.
+func symbolTable(set asm.ISA) asm.Debug {
+	var debug asm.Debug
+	switch {
+	case *symbols != "":
+		f, err := os.Open(*symbols)
+		if err != nil {
+			log.Fatal(err)
+		}
+		debug, err = asm.ReadDebug(f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		_ = f.Close()
+	case *source != "":
+		src, err := os.ReadFile(*source)
+		if err != nil {
+			log.Fatal(err)
+		}
+		_, debug, err = asm.Link([]asm.Source{{Name: *source, Code: string(src)}}, asm.Options{ISA: set})
+		if err != nil {
+			diagnostic.Fatal(diagnostic.Text, err)
+		}
+	}
+	return debug
+}
+
 func parseProgram(filename string) ([]uint16, error) {
 	f, err := os.Open(filename)
 	if err != nil {
@@ -42,26 +218,9 @@ func parseProgram(filename string) ([]uint16, error) {
 			log.Fatal(err)
 		}
 	}()
-
-	program := make([]uint16, 0)
-	scn := bufio.NewScanner(f)
-	for scn.Scan() {
-		text := scn.Text()
-		var instruction uint16
-		for i := range 16 {
-			switch text[i] {
-			case '0':
-				instruction = instruction | uint16(0<<(15-i))
-			case '1':
-				instruction = instruction | uint16(1<<(15-i))
-			default:
-				panic("unexpected character in instruction " + text)
-			}
-		}
-		program = append(program, instruction)
-	}
-	if err := scn.Err(); err != nil {
-		return nil, err
+	ff := hackfile.Format(*format)
+	if ff == "" {
+		ff = hackfile.FormatOf(filename)
 	}
-	return program, nil
+	return hackfile.Read(filename, f, ff)
 }
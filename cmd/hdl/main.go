@@ -4,15 +4,17 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"github.com/crookdc/nand2tetris/diagnostic"
 	"github.com/crookdc/nand2tetris/hdl"
 	"log"
 	"os"
 )
 
 var (
-	file   = flag.String("file", "", "name of file containing HDL under test")
-	target = flag.String("target", "", "name of target under test")
-	tests  = flag.String("tests", "", "name of test file")
+	file        = flag.String("file", "", "name of file containing HDL under test")
+	target      = flag.String("target", "", "name of target under test")
+	tests       = flag.String("tests", "", "name of test file")
+	diagnostics = flag.String("diagnostics", "text", "format of reported problems, either text or json")
 )
 
 func main() {
@@ -34,7 +36,7 @@ func main() {
 	b := hdl.NewBreadboard()
 	c, err := compileTarget(b)
 	if err != nil {
-		log.Fatal(err)
+		diagnostic.Fatal(diagnostic.Format(*diagnostics), err)
 	}
 	for _, t := range comparisons {
 		if err := execute(t, c, b); err != nil {
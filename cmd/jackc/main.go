@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/crookdc/nand2tetris/asm"
+	"github.com/crookdc/nand2tetris/diagnostic"
+	"github.com/crookdc/nand2tetris/hackfile"
+	"github.com/crookdc/nand2tetris/jack"
+	"github.com/crookdc/nand2tetris/vm"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	source      = flag.String("source", "", "a Jack file or a directory containing Jack files")
+	ast         = flag.Bool("ast", false, "print the parsed classes instead of compiling them")
+	hack        = flag.String("hack", "", "translate and assemble the compiled classes into this Hack binary file")
+	symbols     = flag.String("symbols", "", "path of a file to write the symbols and VM origins of the Hack binary to")
+	osDir       = flag.String("os", "", "a directory of VM files implementing the operating system, linked into the Hack binary")
+	diagnostics = flag.String("diagnostics", "text", "format of reported problems, either text or json")
+)
+
+func main() {
+	flag.Parse()
+	if *source == "" {
+		log.Fatal("no source provided")
+	}
+	files, err := jack.Files(*source)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var problems diagnostic.List
+	classes := make([]jack.Class, 0, len(files))
+	for _, file := range files {
+		class, err := jack.ParseFile(file)
+		if err != nil {
+			problems.Add(err)
+			continue
+		}
+		classes = append(classes, class)
+	}
+	if err := problems.Err(); err != nil {
+		diagnostic.Fatal(diagnostic.Format(*diagnostics), err)
+	}
+	if *ast {
+		for _, class := range classes {
+			fmt.Println(class.Literal())
+		}
+		return
+	}
+	compiled := make([][]string, len(classes))
+	for i, class := range classes {
+		compiled[i], err = jack.Compile(class)
+		problems.Add(err)
+	}
+	if err := problems.Err(); err != nil {
+		diagnostic.Fatal(diagnostic.Format(*diagnostics), err)
+	}
+	if *hack == "" {
+		// Without a Hack target each class is written as a VM file next to the Jack file it was compiled from.
+		for i, file := range files {
+			out := strings.TrimSuffix(file, filepath.Ext(file)) + ".vm"
+			if err := os.WriteFile(out, []byte(strings.Join(compiled[i], "\n")+"\n"), 0666); err != nil {
+				log.Fatal(err)
+			}
+		}
+		return
+	}
+	sources := make([]vm.Source, len(classes))
+	for i, class := range classes {
+		sources[i] = vm.Source{
+			Name:   class.Name + ".vm",
+			Reader: strings.NewReader(strings.Join(compiled[i], "\n")),
+		}
+	}
+	if *osDir != "" {
+		system, err := vm.ReadSources(*osDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sources = append(sources, system...)
+	}
+	// Jack programs are started by the operating system through Sys.init, so the bootstrap code is always included. The
+	// output is kept as small as possible since programs linked with the operating system easily outgrow the ROM. The
+	// binary must hold the entire program, hence calls to functions that are neither compiled nor part of the operating
+	// system are reported rather than left for the assembler to mistake for variables.
+	opts := vm.Options{Bootstrap: true, Optimize: true, Trampolines: true, Complete: true}
+	assembly, origins, err := vm.TranslateDebug(sources, opts)
+	if err != nil {
+		diagnostic.Fatal(diagnostic.Format(*diagnostics), err)
+	}
+	program, debug, err := asm.AssembleGenerated("", assembly, origins)
+	if err != nil {
+		diagnostic.Fatal(diagnostic.Format(*diagnostics), err)
+	}
+	if *symbols != "" {
+		if err := asm.WriteDebugFile(*symbols, debug); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := writeProgram(*hack, hackfile.Words(program)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func writeProgram(filename string, program []uint16) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := hackfile.Write(f, hackfile.FormatOf(filename), program); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
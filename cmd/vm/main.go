@@ -3,35 +3,71 @@ package main
 import (
 	"flag"
 	"fmt"
+	"github.com/crookdc/nand2tetris/asm"
+	"github.com/crookdc/nand2tetris/diagnostic"
 	"github.com/crookdc/nand2tetris/vm"
 	"log"
 	"os"
+	"strings"
 )
 
 var (
-	file = flag.String("file", "", "a file containing vm code")
+	file        = flag.String("file", "", "a file containing vm code or a directory of such files")
+	output      = flag.String("o", "", "a file to write the assembly to instead of standard output")
+	bootstrap   = flag.Bool("bootstrap", false, "prepend bootstrap code that sets up the stack and calls Sys.init")
+	optimize    = flag.Bool("O", false, "optimize the generated assembly")
+	trampolines = flag.Bool("trampolines", false, "share a single call and return routine between all calls and returns")
+	report      = flag.Bool("report", false, "report the instruction count of every file before and after optimizing, implies -O")
+	diagnostics = flag.String("diagnostics", "text", "format of reported problems, either text or json")
+	symbols     = flag.String("symbols", "", "path of a file to write the symbols and VM origins of the assembled program to")
 )
 
 func main() {
 	flag.Parse()
 	if *file == "" {
 		flag.Usage()
+		os.Exit(2)
 	}
-
-	f, err := os.OpenFile(*file, os.O_RDONLY, 0666)
+	opts := vm.Options{
+		Bootstrap:   *bootstrap,
+		Optimize:    *optimize || *report,
+		Trampolines: *trampolines,
+	}
+	if *report {
+		opts.Optimized = func(source string, before, after int) {
+			saved := 0.0
+			if before > 0 {
+				saved = float64(before-after) / float64(before) * 100
+			}
+			fmt.Fprintf(os.Stderr, "%s: %d -> %d instructions (%.1f%% fewer)\n", source, before, after, saved)
+		}
+	}
+	sources, err := vm.ReadSources(*file)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer func() {
-		if err := f.Close(); err != nil {
+	program, origins, err := vm.TranslateDebug(sources, opts)
+	if err != nil {
+		diagnostic.Fatal(diagnostic.Format(*diagnostics), err)
+	}
+	if *symbols != "" {
+		// The program is assembled just to find the ROM address of every line, it is up to the assembler to produce
+		// the binary from the written assembly which yields the very same addresses.
+		_, debug, err := asm.AssembleGenerated(*output, program, origins)
+		if err != nil {
+			diagnostic.Fatal(diagnostic.Format(*diagnostics), err)
+		}
+		if err := asm.WriteDebugFile(*symbols, debug); err != nil {
 			log.Fatal(err)
 		}
-	}()
-	asm, err := vm.Translate(*file, f)
-	if err != nil {
-		log.Fatal(err)
 	}
-	for _, ins := range asm {
-		fmt.Println(ins)
+	if *output == "" {
+		for _, ins := range program {
+			fmt.Println(ins)
+		}
+		return
+	}
+	if err := os.WriteFile(*output, []byte(strings.Join(program, "\n")+"\n"), 0666); err != nil {
+		log.Fatal(err)
 	}
 }
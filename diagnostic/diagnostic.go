@@ -0,0 +1,205 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/crookdc/nand2tetris/lexer"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+)
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+// Severity describes how serious a Diagnostic is. Only diagnostics with the Error severity cause a List to be reported
+// as an error.
+type Severity int
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Range is a section of a source file. End is exclusive and equal to Start when only a single point is known.
+type Range struct {
+	Start lexer.Position `json:"start"`
+	End   lexer.Position `json:"end"`
+}
+
+// At returns a Range that only covers pos.
+func At(pos lexer.Position) Range {
+	return Range{Start: pos, End: pos}
+}
+
+// Diagnostic is a single problem found in a source file along with an optional hint on how to resolve it.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	Range    Range    `json:"range"`
+	Hint     string   `json:"hint,omitempty"`
+}
+
+// Errorf constructs a Diagnostic with the Error severity.
+func Errorf(r Range, format string, args ...any) Diagnostic {
+	return Diagnostic{
+		Severity: Error,
+		Message:  fmt.Sprintf(format, args...),
+		Range:    r,
+	}
+}
+
+// Warningf constructs a Diagnostic with the Warning severity.
+func Warningf(r Range, format string, args ...any) Diagnostic {
+	return Diagnostic{
+		Severity: Warning,
+		Message:  fmt.Sprintf(format, args...),
+		Range:    r,
+	}
+}
+
+// From converts err into a Diagnostic. Source positions are recovered from any lexer.Error in the chain of err while
+// other errors produce a Diagnostic without a position.
+func From(err error) Diagnostic {
+	var d Diagnostic
+	if errors.As(err, &d) {
+		return d
+	}
+	var lerr *lexer.Error
+	if errors.As(err, &lerr) {
+		end := lerr.End
+		if end == (lexer.Position{}) {
+			end = lerr.Position
+		}
+		return Diagnostic{
+			Severity: Error,
+			Message:  lerr.Err.Error(),
+			Range:    Range{Start: lerr.Position, End: end},
+		}
+	}
+	return Diagnostic{
+		Severity: Error,
+		Message:  err.Error(),
+	}
+}
+
+// WithHint returns a copy of d with its hint set to hint.
+func (d Diagnostic) WithHint(hint string) Diagnostic {
+	d.Hint = hint
+	return d
+}
+
+// Error formats the Diagnostic like any other positioned error, that is "file:line:col: message". The severity and hint
+// are left out, use Write to format a Diagnostic for human consumption.
+func (d Diagnostic) Error() string {
+	if d.Range.Start.Line == 0 {
+		return d.Message
+	}
+	return fmt.Sprintf("%s: %s", d.Range.Start, d.Message)
+}
+
+// List is an ordered collection of diagnostics. A List is itself an error so that functions that previously returned
+// the first error found can return every problem without changing their signature.
+type List []Diagnostic
+
+// Add appends the Diagnostic derived from err to the List.
+func (l *List) Add(err error) {
+	if err == nil {
+		return
+	}
+	var list List
+	if errors.As(err, &list) {
+		*l = append(*l, list...)
+		return
+	}
+	*l = append(*l, From(err))
+}
+
+// Err returns the List as an error if it contains at least one Diagnostic with the Error severity and nil otherwise.
+func (l List) Err() error {
+	for _, d := range l {
+		if d.Severity == Error {
+			return l
+		}
+	}
+	return nil
+}
+
+func (l List) Error() string {
+	lines := make([]string, len(l))
+	for i, d := range l {
+		lines[i] = d.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Format names the output formats supported by Write.
+type Format string
+
+const (
+	Text Format = "text"
+	JSON Format = "json"
+)
+
+// Write reports every Diagnostic found in err to w in the requested Format. The Text format mimics the output of
+// common compilers, "file:line:col: severity: message", followed by an indented hint if one is present. The JSON format
+// writes a single array of diagnostics suitable for consumption by editors.
+func Write(w io.Writer, format Format, err error) error {
+	list := make(List, 0)
+	list.Add(err)
+	slices.SortStableFunc(list, func(a, b Diagnostic) int {
+		if c := strings.Compare(a.Range.Start.File, b.Range.Start.File); c != 0 {
+			return c
+		}
+		return a.Range.Start.Offset - b.Range.Start.Offset
+	})
+	switch format {
+	case Text:
+		for _, d := range list {
+			if d.Range.Start.Line == 0 {
+				if _, err := fmt.Fprintf(w, "%s: %s\n", d.Severity, d.Message); err != nil {
+					return err
+				}
+			} else if _, err := fmt.Fprintf(w, "%s: %s: %s\n", d.Range.Start, d.Severity, d.Message); err != nil {
+				return err
+			}
+			if d.Hint == "" {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "\thint: %s\n", d.Hint); err != nil {
+				return err
+			}
+		}
+		return nil
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(list)
+	default:
+		return fmt.Errorf("unsupported diagnostic format: %s", format)
+	}
+}
+
+// Fatal writes the diagnostics of err to standard error in the requested Format and exits the program with a non-zero
+// status code, much like log.Fatal.
+func Fatal(format Format, err error) {
+	if werr := Write(os.Stderr, format, err); werr != nil {
+		log.Println(werr)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,86 @@
+package diagnostic
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/crookdc/nand2tetris/lexer"
+	"testing"
+)
+
+func TestList_Err(t *testing.T) {
+	var list List
+	if list.Err() != nil {
+		t.Errorf("expected empty list to not be an error")
+	}
+	list = append(list, Warningf(Range{}, "unused"))
+	if list.Err() != nil {
+		t.Errorf("expected list of warnings to not be an error")
+	}
+	list = append(list, Errorf(Range{}, "broken"))
+	if list.Err() == nil {
+		t.Errorf("expected list containing an error to be an error")
+	}
+}
+
+func TestList_Add(t *testing.T) {
+	var list List
+	list.Add(nil)
+	list.Add(lexer.Errorf(lexer.Position{File: "a.asm", Line: 2, Column: 3}, "first"))
+	list.Add(List{Errorf(Range{}, "second"), Errorf(Range{}, "third")})
+	list.Add(errors.New("fourth"))
+	if len(list) != 4 {
+		t.Fatalf("expected 4 diagnostics but got %d", len(list))
+	}
+	if list[0].Range.Start.Line != 2 || list[0].Range.End.Column != 3 {
+		t.Errorf("expected position to be recovered from lexer error but got %+v", list[0].Range)
+	}
+	if list[0].Message != "first" {
+		t.Errorf("expected message to not repeat the position but got %q", list[0].Message)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	list := List{
+		Errorf(At(lexer.Position{File: "a.asm", Line: 4, Column: 1, Offset: 20}), "second"),
+		Errorf(At(lexer.Position{File: "a.asm", Line: 1, Column: 2, Offset: 1}), "first").WithHint("try harder"),
+		Warningf(Range{}, "third"),
+	}
+	tests := []struct {
+		format   Format
+		expected string
+	}{
+		{
+			format: Text,
+			expected: "warning: third\n" +
+				"a.asm:1:2: error: first\n" +
+				"\thint: try harder\n" +
+				"a.asm:4:1: error: second\n",
+		},
+		{
+			format: JSON,
+			expected: `[{"severity":"warning","message":"third","range":{"start":{"line":0,"column":0,"offset":0},"end":{"line":0,"column":0,"offset":0}}},` +
+				`{"severity":"error","message":"first","range":{"start":{"file":"a.asm","line":1,"column":2,"offset":1},"end":{"file":"a.asm","line":1,"column":2,"offset":1}},"hint":"try harder"},` +
+				`{"severity":"error","message":"second","range":{"start":{"file":"a.asm","line":4,"column":1,"offset":20},"end":{"file":"a.asm","line":4,"column":1,"offset":20}}}]`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(string(test.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, test.format, list); err != nil {
+				t.Fatal(err)
+			}
+			actual := buf.String()
+			if test.format == JSON {
+				var compact bytes.Buffer
+				if err := json.Compact(&compact, buf.Bytes()); err != nil {
+					t.Fatal(err)
+				}
+				actual = compact.String()
+			}
+			if actual != test.expected {
+				t.Errorf("expected %q but got %q", test.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+// Package hackfile reads and writes Hack machine code programs in the formats understood by the assembler and the
+// simulator.
+package hackfile
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/crookdc/nand2tetris/lexer"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Size is the number of instructions that fit in the ROM of the Hack computer.
+const Size = 32768
+
+// Format names the file formats supported by Read and Write.
+type Format string
+
+const (
+	// Text is the standard .hack format of one instruction per line written as 16 characters of 0 and 1.
+	Text Format = "text"
+	// BigEndian and LittleEndian are raw images of two bytes per instruction.
+	BigEndian    Format = "be"
+	LittleEndian Format = "le"
+	// IntelHex is the Intel HEX format commonly used to program ROM chips. Every instruction occupies two bytes, most
+	// significant byte first, such that instruction i is found at byte address 2i.
+	IntelHex Format = "ihex"
+)
+
+// FormatOf guesses the Format of a file from its extension, falling back to Text.
+func FormatOf(filename string) Format {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".bin":
+		return BigEndian
+	case ".hex", ".ihex":
+		return IntelHex
+	default:
+		return Text
+	}
+}
+
+// Words converts a program as produced by the assembler into the instruction words loaded by the simulator.
+func Words(program [][16]byte) []uint16 {
+	words := make([]uint16, len(program))
+	for i, ins := range program {
+		for _, bit := range ins {
+			words[i] = words[i]<<1 | uint16(bit)
+		}
+	}
+	return words
+}
+
+// Read reads a program in the given Format from r. The name of the file is used when reporting problems, which for the
+// line based formats also refer to the line at fault.
+func Read(name string, r io.Reader, format Format) ([]uint16, error) {
+	var program []uint16
+	var err error
+	switch format {
+	case Text:
+		program, err = readText(name, r)
+	case BigEndian:
+		program, err = readBinary(name, r, binary.BigEndian)
+	case LittleEndian:
+		program, err = readBinary(name, r, binary.LittleEndian)
+	case IntelHex:
+		program, err = readIntelHex(name, r)
+	default:
+		return nil, fmt.Errorf("unsupported program format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(program) > Size {
+		return nil, fmt.Errorf("%s: program of %d instructions does not fit in ROM of %d", name, len(program), Size)
+	}
+	return program, nil
+}
+
+// readText reads the text format, accepting blank lines and Windows line endings.
+func readText(name string, r io.Reader) ([]uint16, error) {
+	program := make([]uint16, 0)
+	scn := bufio.NewScanner(r)
+	for line := 1; scn.Scan(); line++ {
+		text := strings.TrimRight(scn.Text(), " \t\r")
+		if text == "" {
+			continue
+		}
+		pos := lexer.Position{File: name, Line: line, Column: 1}
+		if len(text) != 16 {
+			return nil, lexer.Errorf(pos, "expected 16 bits but found %d characters", len(text))
+		}
+		var ins uint16
+		for i := range 16 {
+			switch text[i] {
+			case '0':
+				ins = ins << 1
+			case '1':
+				ins = ins<<1 | 1
+			default:
+				pos.Column = i + 1
+				return nil, lexer.Errorf(pos, "unexpected character %q in instruction", text[i])
+			}
+		}
+		program = append(program, ins)
+	}
+	if err := scn.Err(); err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+func readBinary(name string, r io.Reader, order binary.ByteOrder) ([]uint16, error) {
+	image, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return decode(name, image, order)
+}
+
+func decode(name string, image []byte, order binary.ByteOrder) ([]uint16, error) {
+	if len(image)%2 != 0 {
+		return nil, fmt.Errorf("%s: image of %d bytes is not a whole number of instructions", name, len(image))
+	}
+	program := make([]uint16, len(image)/2)
+	for i := range program {
+		program[i] = order.Uint16(image[2*i:])
+	}
+	return program, nil
+}
+
+// readIntelHex reads data, end of file and extended address records. Bytes not covered by any record are zero.
+func readIntelHex(name string, r io.Reader) ([]uint16, error) {
+	image := make([]byte, 2*Size)
+	size := 0
+	base := 0
+	scn := bufio.NewScanner(r)
+	line := 0
+	for scn.Scan() {
+		line++
+		pos := lexer.Position{File: name, Line: line, Column: 1}
+		text := strings.TrimSpace(scn.Text())
+		if text == "" {
+			continue
+		}
+		if text[0] != ':' {
+			return nil, lexer.Errorf(pos, "record does not start with ':'")
+		}
+		record, err := hex.DecodeString(text[1:])
+		if err != nil {
+			return nil, lexer.Errorf(pos, "invalid record: %w", err)
+		}
+		if len(record) < 5 || len(record) != int(record[0])+5 {
+			return nil, lexer.Errorf(pos, "record length does not match its byte count")
+		}
+		var sum byte
+		for _, b := range record {
+			sum += b
+		}
+		if sum != 0 {
+			return nil, lexer.Errorf(pos, "checksum mismatch")
+		}
+		data := record[4 : len(record)-1]
+		switch record[3] {
+		case 0x00:
+			addr := base + int(binary.BigEndian.Uint16(record[1:3]))
+			if addr+len(data) > len(image) {
+				return nil, lexer.Errorf(pos, "data at byte address %d does not fit in ROM", addr)
+			}
+			copy(image[addr:], data)
+			size = max(size, addr+len(data))
+		case 0x01:
+			// A trailing odd byte is the high byte of an instruction whose low byte was left out.
+			return decode(name, image[:size+size%2], binary.BigEndian)
+		case 0x02:
+			if len(data) != 2 {
+				return nil, lexer.Errorf(pos, "extended segment address record must hold 2 bytes")
+			}
+			base = int(binary.BigEndian.Uint16(data)) << 4
+		case 0x04:
+			if len(data) != 2 {
+				return nil, lexer.Errorf(pos, "extended linear address record must hold 2 bytes")
+			}
+			base = int(binary.BigEndian.Uint16(data)) << 16
+		case 0x03, 0x05:
+			// Start address records have no meaning for the Hack computer, which always starts at address 0.
+		default:
+			return nil, lexer.Errorf(pos, "unsupported record type %02X", record[3])
+		}
+	}
+	if err := scn.Err(); err != nil {
+		return nil, err
+	}
+	return nil, lexer.Errorf(lexer.Position{File: name, Line: line + 1, Column: 1}, "missing end of file record")
+}
+
+// Write writes program to w in the given Format.
+func Write(w io.Writer, format Format, program []uint16) error {
+	if len(program) > Size {
+		return fmt.Errorf("program of %d instructions does not fit in ROM of %d", len(program), Size)
+	}
+	bw := bufio.NewWriter(w)
+	switch format {
+	case Text:
+		for _, ins := range program {
+			if _, err := fmt.Fprintf(bw, "%016b\n", ins); err != nil {
+				return err
+			}
+		}
+	case BigEndian:
+		if err := binary.Write(bw, binary.BigEndian, program); err != nil {
+			return err
+		}
+	case LittleEndian:
+		if err := binary.Write(bw, binary.LittleEndian, program); err != nil {
+			return err
+		}
+	case IntelHex:
+		if err := writeIntelHex(bw, program); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported program format: %s", format)
+	}
+	return bw.Flush()
+}
+
+// writeIntelHex writes data records of 16 bytes each. The ROM spans exactly 64KiB so no extended address records are
+// ever needed.
+func writeIntelHex(w io.Writer, program []uint16) error {
+	image := make([]byte, 2*len(program))
+	for i, ins := range program {
+		binary.BigEndian.PutUint16(image[2*i:], ins)
+	}
+	for addr := 0; addr < len(image); addr += 16 {
+		data := image[addr:min(addr+16, len(image))]
+		record := append([]byte{byte(len(data)), byte(addr >> 8), byte(addr), 0x00}, data...)
+		if err := writeRecord(w, record); err != nil {
+			return err
+		}
+	}
+	return writeRecord(w, []byte{0x00, 0x00, 0x00, 0x01})
+}
+
+func writeRecord(w io.Writer, record []byte) error {
+	var sum byte
+	for _, b := range record {
+		sum += b
+	}
+	_, err := fmt.Fprintf(w, ":%s%02X\n", strings.ToUpper(hex.EncodeToString(record)), -sum)
+	return err
+}
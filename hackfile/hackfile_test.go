@@ -0,0 +1,146 @@
+package hackfile
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	program := []uint16{0x0010, 0xEC10, 0x7FFF}
+	tests := []struct {
+		format   Format
+		expected string
+	}{
+		{
+			format:   Text,
+			expected: "0000000000010000\n1110110000010000\n0111111111111111\n",
+		},
+		{
+			format:   BigEndian,
+			expected: "\x00\x10\xEC\x10\x7F\xFF",
+		},
+		{
+			format:   LittleEndian,
+			expected: "\x10\x00\x10\xEC\xFF\x7F",
+		},
+		{
+			format:   IntelHex,
+			expected: ":060000000010EC107FFF70\n:00000001FF\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(string(test.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, test.format, program); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != test.expected {
+				t.Fatalf("expected %q but got %q", test.expected, buf.String())
+			}
+			actual, err := Read("Main.hack", &buf, test.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actual, program) {
+				t.Errorf("expected %v but got %v", program, actual)
+			}
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		format   Format
+		src      string
+		expected []uint16
+	}{
+		{
+			format:   Text,
+			src:      "0000000000010000\r\n1110110000010000\r\n\r\n",
+			expected: []uint16{0x0010, 0xEC10},
+		},
+		{
+			format:   IntelHex,
+			src:      ":020004000010EA\n:0100000000FF\n:00000001FF\n",
+			expected: []uint16{0x0000, 0x0000, 0x0010},
+		},
+		{
+			format:   IntelHex,
+			src:      ":03000000001000ED\n:00000001FF\n",
+			expected: []uint16{0x0010, 0x0000},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			actual, err := Read("Main.hack", strings.NewReader(test.src), test.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("expected %v but got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRead_errors(t *testing.T) {
+	tests := []struct {
+		format   Format
+		src      string
+		expected string
+	}{
+		{
+			format:   Text,
+			src:      "0000000000010000\n11101100000100\n",
+			expected: "Main.hack:2:1: expected 16 bits but found 14 characters",
+		},
+		{
+			format:   Text,
+			src:      "0000000000010000\n\n111011000002000\n",
+			expected: "Main.hack:3:1: expected 16 bits but found 15 characters",
+		},
+		{
+			format:   Text,
+			src:      "1110110000x10000\n",
+			expected: "Main.hack:1:11: unexpected character 'x' in instruction",
+		},
+		{
+			format:   BigEndian,
+			src:      "\x00\x10\xEC",
+			expected: "Main.hack: image of 3 bytes is not a whole number of instructions",
+		},
+		{
+			format:   BigEndian,
+			src:      strings.Repeat("\x00", 2*Size+2),
+			expected: "Main.hack: program of 32769 instructions does not fit in ROM of 32768",
+		},
+		{
+			format:   IntelHex,
+			src:      ":020000000010EF\n:00000001FF\n",
+			expected: "Main.hack:1:1: checksum mismatch",
+		},
+		{
+			format:   IntelHex,
+			src:      ":020000000010EE\n",
+			expected: "Main.hack:2:1: missing end of file record",
+		},
+		{
+			format:   IntelHex,
+			src:      ":020000000010EE\n020000000010EE\n",
+			expected: "Main.hack:2:1: record does not start with ':'",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			_, err := Read("Main.hack", strings.NewReader(test.src), test.format)
+			if err == nil {
+				t.Fatal("expected an error but got nil")
+			}
+			if err.Error() != test.expected {
+				t.Errorf("expected %q but got %q", test.expected, err.Error())
+			}
+		})
+	}
+}
@@ -3,10 +3,12 @@ package hdl
 import (
 	"errors"
 	"fmt"
+	"github.com/crookdc/nand2tetris/diagnostic"
 	"github.com/crookdc/nand2tetris/lexer"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -82,23 +84,30 @@ func LoadedLexer(src string) *lexer.Lexer[variant] {
 	return l
 }
 
+// LoadedFileLexer works like LoadedLexer but attributes every token to the named file.
+func LoadedFileLexer(file string, src string) *lexer.Lexer[variant] {
+	l := NewLexer()
+	l.LoadFile(file, src)
+	return l
+}
+
 func ParseFile(filename string) (map[string]ChipStatement, error) {
 	src, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
-	p := NewParser(LoadedLexer(string(src)))
+	p := NewParser(LoadedFileLexer(filename, string(src)))
 	c := make(map[string]ChipStatement)
+	var diagnostics diagnostic.List
 	stmts, err := p.Parse()
-	if err != nil {
-		return nil, err
-	}
+	diagnostics.Add(err)
 	for _, s := range stmts {
 		switch t := s.(type) {
 		case UseStatement:
 			imported, err := ParseFile(filepath.Join(filepath.Dir(filename), t.FileName))
 			if err != nil {
-				return nil, err
+				diagnostics.Add(err)
+				continue
 			}
 			for name, definition := range imported {
 				c[name] = definition
@@ -107,6 +116,9 @@ func ParseFile(filename string) (map[string]ChipStatement, error) {
 			c[t.Name] = t
 		}
 	}
+	if err := diagnostics.Err(); err != nil {
+		return nil, err
+	}
 	return c, nil
 }
 
@@ -125,26 +137,56 @@ func NewParser(lexer *lexer.Lexer[variant]) Parser {
 }
 
 type Parser struct {
-	lexer *lexer.Lexer[variant]
+	lexer       *lexer.Lexer[variant]
+	diagnostics diagnostic.List
 }
 
+// Parse reads every statement from the underlying lexer. A malformed statement does not stop the parser, it is reported
+// and the parser resumes at the next statement. Hence, the returned error is a diagnostic.List covering every problem
+// in the source while the returned statements are those that could be parsed.
 func (p *Parser) Parse() ([]Statement, error) {
+	p.diagnostics = nil
 	stmts := make([]Statement, 0)
 	for {
 		ch, err := p.parse()
 		if err != nil {
-			return nil, err
+			p.diagnostics.Add(err)
+			p.synchronize(chip, use)
+		} else {
+			stmts = append(stmts, ch)
 		}
-		stmts = append(stmts, ch)
-		_, err = p.lexer.Peek()
-		if errors.Is(err, io.EOF) {
+		if !p.more() {
 			break
 		}
+	}
+	return stmts, p.diagnostics.Err()
+}
+
+// more reports whether there are more tokens to parse. Any problem reading the next token is left to be reported by
+// the next parsing operation.
+func (p *Parser) more() bool {
+	_, err := p.lexer.Peek()
+	return !errors.Is(err, io.EOF)
+}
+
+// synchronize discards tokens until the next token is of one of the provided variants or the source is exhausted.
+func (p *Parser) synchronize(variants ...variant) {
+	for {
+		tok, err := p.lexer.Peek()
+		if errors.Is(err, io.EOF) {
+			return
+		}
 		if err != nil {
-			return nil, err
+			// The lexer cannot make sense of the source at the cursor so everything up to the next whitespace is skipped.
+			p.lexer.Skip()
+			_ = p.lexer.Seek(lexer.Whitespace[variant])
+			continue
+		}
+		if slices.Contains(variants, tok.Variant) {
+			return
 		}
+		_, _ = p.lexer.Next()
 	}
-	return stmts, nil
 }
 
 func (p *Parser) parse() (Statement, error) {
@@ -162,7 +204,7 @@ func (p *Parser) parse() (Statement, error) {
 		}
 		return UseStatement{FileName: filename.Literal}, nil
 	default:
-		return nil, fmt.Errorf("unexpected token '%s'", tok.Literal)
+		return nil, lexer.TokenErrorf(tok, "unexpected token '%s'", tok.Literal)
 	}
 }
 
@@ -283,13 +325,18 @@ func (p *Parser) parseStatementBlock() ([]Statement, error) {
 	for tok.Variant != rightCurlyBrace {
 		statement, err := p.parseStatement()
 		if err != nil {
-			return nil, err
+			p.diagnostics.Add(err)
+			p.synchronize(out, set, rightCurlyBrace, chip, use)
+		} else {
+			statements = append(statements, statement)
 		}
-		statements = append(statements, statement)
 		tok, err = p.lexer.Peek()
 		if err != nil {
 			return nil, err
 		}
+		if tok.Variant == chip || tok.Variant == use {
+			return nil, lexer.TokenErrorf(tok, "expected '}' but found '%s'", tok.Literal)
+		}
 	}
 	if _, err := p.expect(rightCurlyBrace); err != nil {
 		return nil, err
@@ -312,7 +359,7 @@ func (p *Parser) parseStatement() (Statement, error) {
 	case set:
 		return p.parseSetStatement()
 	default:
-		return nil, fmt.Errorf("unexpected token '%s'", tok.Literal)
+		return nil, lexer.TokenErrorf(tok, "unexpected token '%s'", tok.Literal)
 	}
 }
 
@@ -352,7 +399,7 @@ func (p *Parser) parseExpression() (Expression, error) {
 	case leftBracket:
 		return p.parseArrayExpression()
 	default:
-		return nil, fmt.Errorf("unexpected token '%s'", tok.Literal)
+		return nil, lexer.TokenErrorf(tok, "unexpected token '%s'", tok.Literal)
 	}
 }
 
@@ -444,7 +491,7 @@ func (p *Parser) expect(v variant) (lexer.Token[variant], error) {
 		return lexer.Token[variant]{}, err
 	}
 	if tok.Variant != v {
-		return lexer.Token[variant]{}, fmt.Errorf("unexpected token '%s'", tok.Literal)
+		return lexer.Token[variant]{}, lexer.TokenErrorf(tok, "unexpected token '%s'", tok.Literal)
 	}
 	return tok, nil
 }
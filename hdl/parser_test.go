@@ -2,6 +2,7 @@ package hdl
 
 import (
 	"errors"
+	"github.com/crookdc/nand2tetris/diagnostic"
 	"reflect"
 	"testing"
 )
@@ -240,3 +241,70 @@ func TestParser_Parse(t *testing.T) {
 		})
 	}
 }
+
+func TestParser_Parse_errors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{
+			src:      "chip not (in: 1) -> (1) {\n\tout nand(in: [in.0, 1])\n\tin\n}",
+			expected: "not.hdl:3:2: unexpected token 'in'",
+		},
+		{
+			src:      "use \"not.hdl\"\nchip 12",
+			expected: "not.hdl:2:6: unexpected token '12'",
+		},
+		{
+			src:      "chip not (in: 1) -> (1) {\n\tout nand(in: [in.0, 1]) #\n}",
+			expected: "not.hdl:2:26: all delegates failed to process character '#'",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			parser := NewParser(LoadedFileLexer("not.hdl", test.src))
+			_, err := parser.Parse()
+			if err == nil {
+				t.Fatal("expected an error but got nil")
+			}
+			if err.Error() != test.expected {
+				t.Errorf("expected %q but got %q", test.expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestParser_Parse_recovery(t *testing.T) {
+	src := `
+	chip broken (in: 1) -> (1) {
+		out nand(in: [in.0, 1])
+		in
+		out 1
+		set x = )
+	}
+	chip 12
+	chip fine (in: 1) -> (1) {
+		out in
+	}`
+	parser := NewParser(LoadedFileLexer("broken.hdl", src))
+	stmts, err := parser.Parse()
+	var list diagnostic.List
+	if !errors.As(err, &list) {
+		t.Fatalf("expected a diagnostic list but got %v", err)
+	}
+	expected := []int{4, 6, 8}
+	if len(list) != len(expected) {
+		t.Fatalf("expected %d diagnostics but got %d: %v", len(expected), len(list), list)
+	}
+	for i, line := range expected {
+		if list[i].Range.Start.Line != line {
+			t.Errorf("expected diagnostic %d on line %d but got %s", i, line, list[i])
+		}
+	}
+	if len(stmts) != 2 {
+		t.Fatalf("expected 2 statements to be recovered but got %d", len(stmts))
+	}
+	if stmts[1].(ChipStatement).Name != "fine" {
+		t.Errorf("expected chip following the errors to be parsed but got %s", stmts[1].Literal())
+	}
+}
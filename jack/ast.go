@@ -0,0 +1,424 @@
+package jack
+
+import (
+	"fmt"
+	"github.com/crookdc/nand2tetris/lexer"
+	"strconv"
+	"strings"
+)
+
+// Node is implemented by every element of the abstract syntax tree produced by the Parser. Literal returns the Jack
+// source that the node represents in a canonical form.
+type Node interface {
+	Literal() string
+	Pos() lexer.Position
+}
+
+type Statement interface {
+	Node
+	statement()
+}
+
+type Expression interface {
+	Node
+	expression()
+}
+
+type Class struct {
+	Name        string
+	Variables   []ClassVariable
+	Subroutines []Subroutine
+	Position    lexer.Position
+}
+
+func (c Class) Pos() lexer.Position {
+	return c.Position
+}
+
+func (c Class) Literal() string {
+	body := make([]string, 0, len(c.Variables)+len(c.Subroutines))
+	for _, v := range c.Variables {
+		body = append(body, v.Literal())
+	}
+	for _, s := range c.Subroutines {
+		body = append(body, s.Literal())
+	}
+	return fmt.Sprintf("class %s { %s }", c.Name, strings.Join(body, " "))
+}
+
+type VariableKind int
+
+const (
+	Static VariableKind = iota
+	Field
+	Argument
+	Local
+)
+
+func (k VariableKind) String() string {
+	switch k {
+	case Static:
+		return "static"
+	case Field:
+		return "field"
+	case Argument:
+		return "argument"
+	case Local:
+		return "local"
+	default:
+		return fmt.Sprintf("VariableKind(%d)", int(k))
+	}
+}
+
+// Type is the name of a type as it appears in the source, either one of the primitive types int, char and boolean or
+// the name of a class. The return type of subroutines may also be void.
+type Type string
+
+const (
+	Int     Type = "int"
+	Char    Type = "char"
+	Boolean Type = "boolean"
+	Void    Type = "void"
+)
+
+// ClassVariable is a static or field declaration in the body of a class.
+type ClassVariable struct {
+	Kind     VariableKind
+	Type     Type
+	Names    []string
+	Position lexer.Position
+}
+
+func (c ClassVariable) Pos() lexer.Position {
+	return c.Position
+}
+
+func (c ClassVariable) Literal() string {
+	return fmt.Sprintf("%s %s %s;", c.Kind, c.Type, strings.Join(c.Names, ", "))
+}
+
+type SubroutineKind int
+
+const (
+	Constructor SubroutineKind = iota
+	Function
+	Method
+)
+
+func (k SubroutineKind) String() string {
+	switch k {
+	case Constructor:
+		return "constructor"
+	case Function:
+		return "function"
+	case Method:
+		return "method"
+	default:
+		return fmt.Sprintf("SubroutineKind(%d)", int(k))
+	}
+}
+
+type Subroutine struct {
+	Kind       SubroutineKind
+	ReturnType Type
+	Name       string
+	Parameters []Parameter
+	Locals     []LocalVariable
+	Statements []Statement
+	Position   lexer.Position
+}
+
+func (s Subroutine) Pos() lexer.Position {
+	return s.Position
+}
+
+func (s Subroutine) Literal() string {
+	params := make([]string, len(s.Parameters))
+	for i, p := range s.Parameters {
+		params[i] = p.Literal()
+	}
+	body := make([]string, 0, len(s.Locals)+len(s.Statements))
+	for _, l := range s.Locals {
+		body = append(body, l.Literal())
+	}
+	body = append(body, literals(s.Statements)...)
+	return fmt.Sprintf(
+		"%s %s %s(%s) { %s }",
+		s.Kind,
+		s.ReturnType,
+		s.Name,
+		strings.Join(params, ", "),
+		strings.Join(body, " "),
+	)
+}
+
+type Parameter struct {
+	Type     Type
+	Name     string
+	Position lexer.Position
+}
+
+func (p Parameter) Pos() lexer.Position {
+	return p.Position
+}
+
+func (p Parameter) Literal() string {
+	return fmt.Sprintf("%s %s", p.Type, p.Name)
+}
+
+// LocalVariable is a var declaration at the beginning of a subroutine body.
+type LocalVariable struct {
+	Type     Type
+	Names    []string
+	Position lexer.Position
+}
+
+func (l LocalVariable) Pos() lexer.Position {
+	return l.Position
+}
+
+func (l LocalVariable) Literal() string {
+	return fmt.Sprintf("var %s %s;", l.Type, strings.Join(l.Names, ", "))
+}
+
+// LetStatement assigns Value to the variable Name, or to an element of the array referenced by Name if Index is set.
+type LetStatement struct {
+	Name     string
+	Index    Expression
+	Value    Expression
+	Position lexer.Position
+}
+
+func (l LetStatement) statement() {}
+
+func (l LetStatement) Pos() lexer.Position {
+	return l.Position
+}
+
+func (l LetStatement) Literal() string {
+	if l.Index != nil {
+		return fmt.Sprintf("let %s[%s] = %s;", l.Name, l.Index.Literal(), l.Value.Literal())
+	}
+	return fmt.Sprintf("let %s = %s;", l.Name, l.Value.Literal())
+}
+
+// IfStatement executes Then when Condition is true and Else otherwise. Else is nil when the else branch is omitted.
+type IfStatement struct {
+	Condition Expression
+	Then      []Statement
+	Else      []Statement
+	Position  lexer.Position
+}
+
+func (i IfStatement) statement() {}
+
+func (i IfStatement) Pos() lexer.Position {
+	return i.Position
+}
+
+func (i IfStatement) Literal() string {
+	str := fmt.Sprintf("if (%s) { %s }", i.Condition.Literal(), strings.Join(literals(i.Then), " "))
+	if i.Else != nil {
+		str += fmt.Sprintf(" else { %s }", strings.Join(literals(i.Else), " "))
+	}
+	return str
+}
+
+type WhileStatement struct {
+	Condition Expression
+	Body      []Statement
+	Position  lexer.Position
+}
+
+func (w WhileStatement) statement() {}
+
+func (w WhileStatement) Pos() lexer.Position {
+	return w.Position
+}
+
+func (w WhileStatement) Literal() string {
+	return fmt.Sprintf("while (%s) { %s }", w.Condition.Literal(), strings.Join(literals(w.Body), " "))
+}
+
+type DoStatement struct {
+	Call     CallExpression
+	Position lexer.Position
+}
+
+func (d DoStatement) statement() {}
+
+func (d DoStatement) Pos() lexer.Position {
+	return d.Position
+}
+
+func (d DoStatement) Literal() string {
+	return fmt.Sprintf("do %s;", d.Call.Literal())
+}
+
+// ReturnStatement returns from the current subroutine. Value is nil when no value is returned.
+type ReturnStatement struct {
+	Value    Expression
+	Position lexer.Position
+}
+
+func (r ReturnStatement) statement() {}
+
+func (r ReturnStatement) Pos() lexer.Position {
+	return r.Position
+}
+
+func (r ReturnStatement) Literal() string {
+	if r.Value == nil {
+		return "return;"
+	}
+	return fmt.Sprintf("return %s;", r.Value.Literal())
+}
+
+type IntegerConstant struct {
+	Value    int
+	Position lexer.Position
+}
+
+func (i IntegerConstant) expression() {}
+
+func (i IntegerConstant) Pos() lexer.Position {
+	return i.Position
+}
+
+func (i IntegerConstant) Literal() string {
+	return strconv.Itoa(i.Value)
+}
+
+type StringConstant struct {
+	Value    string
+	Position lexer.Position
+}
+
+func (s StringConstant) expression() {}
+
+func (s StringConstant) Pos() lexer.Position {
+	return s.Position
+}
+
+func (s StringConstant) Literal() string {
+	return fmt.Sprintf("\"%s\"", s.Value)
+}
+
+// KeywordConstant is one of the keywords true, false, null and this used as a value.
+type KeywordConstant struct {
+	Keyword  string
+	Position lexer.Position
+}
+
+func (k KeywordConstant) expression() {}
+
+func (k KeywordConstant) Pos() lexer.Position {
+	return k.Position
+}
+
+func (k KeywordConstant) Literal() string {
+	return k.Keyword
+}
+
+type VariableExpression struct {
+	Name     string
+	Position lexer.Position
+}
+
+func (v VariableExpression) expression() {}
+
+func (v VariableExpression) Pos() lexer.Position {
+	return v.Position
+}
+
+func (v VariableExpression) Literal() string {
+	return v.Name
+}
+
+// IndexExpression reads an element of the array referenced by the variable Name.
+type IndexExpression struct {
+	Name     string
+	Index    Expression
+	Position lexer.Position
+}
+
+func (i IndexExpression) expression() {}
+
+func (i IndexExpression) Pos() lexer.Position {
+	return i.Position
+}
+
+func (i IndexExpression) Literal() string {
+	return fmt.Sprintf("%s[%s]", i.Name, i.Index.Literal())
+}
+
+// CallExpression invokes a subroutine. Receiver is the name of a class or variable that precedes the subroutine name,
+// as in Math.multiply(x, y) or list.dispose(), and is empty when a method is called on the current object.
+type CallExpression struct {
+	Receiver  string
+	Name      string
+	Arguments []Expression
+	Position  lexer.Position
+}
+
+func (c CallExpression) expression() {}
+
+func (c CallExpression) Pos() lexer.Position {
+	return c.Position
+}
+
+func (c CallExpression) Literal() string {
+	args := make([]string, len(c.Arguments))
+	for i, arg := range c.Arguments {
+		args[i] = arg.Literal()
+	}
+	if c.Receiver == "" {
+		return fmt.Sprintf("%s(%s)", c.Name, strings.Join(args, ", "))
+	}
+	return fmt.Sprintf("%s.%s(%s)", c.Receiver, c.Name, strings.Join(args, ", "))
+}
+
+// UnaryExpression applies either arithmetic negation (-) or bitwise not (~) to Operand.
+type UnaryExpression struct {
+	Operator byte
+	Operand  Expression
+	Position lexer.Position
+}
+
+func (u UnaryExpression) expression() {}
+
+func (u UnaryExpression) Pos() lexer.Position {
+	return u.Position
+}
+
+func (u UnaryExpression) Literal() string {
+	return fmt.Sprintf("%c%s", u.Operator, u.Operand.Literal())
+}
+
+// BinaryExpression applies one of the operators + - * / & | < > = to Left and Right. Jack does not define any operator
+// precedence, expressions are instead evaluated from left to right which the parser reflects by nesting earlier
+// operations in Left.
+type BinaryExpression struct {
+	Operator byte
+	Left     Expression
+	Right    Expression
+	Position lexer.Position
+}
+
+func (b BinaryExpression) expression() {}
+
+func (b BinaryExpression) Pos() lexer.Position {
+	return b.Position
+}
+
+func (b BinaryExpression) Literal() string {
+	return fmt.Sprintf("(%s %c %s)", b.Left.Literal(), b.Operator, b.Right.Literal())
+}
+
+func literals(stmts []Statement) []string {
+	lits := make([]string, len(stmts))
+	for i, stmt := range stmts {
+		lits[i] = stmt.Literal()
+	}
+	return lits
+}
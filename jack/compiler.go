@@ -0,0 +1,277 @@
+package jack
+
+import (
+	"fmt"
+	"github.com/crookdc/nand2tetris/diagnostic"
+	"github.com/crookdc/nand2tetris/lexer"
+)
+
+// Compile generates the VM commands that implement class, one command per element of the returned slice. The output
+// follows the standard calling conventions of the VM language and can be passed straight to vm.TranslateProgram. Every
+// problem found in class is reported as part of a diagnostic.List.
+func Compile(class Class) ([]string, error) {
+	c := compiler{
+		class:   class,
+		symbols: NewSymbolTable(),
+		vm:      make([]string, 0),
+	}
+	for _, v := range class.Variables {
+		for _, name := range v.Names {
+			if _, err := c.symbols.Define(name, v.Type, v.Kind); err != nil {
+				c.errorf(v, "%v", err)
+			}
+		}
+	}
+	for _, s := range class.Subroutines {
+		c.subroutine(s)
+	}
+	if err := c.diagnostics.Err(); err != nil {
+		return nil, err
+	}
+	return c.vm, nil
+}
+
+type compiler struct {
+	class       Class
+	symbols     *SymbolTable
+	current     Subroutine
+	labels      int
+	vm          []string
+	diagnostics diagnostic.List
+}
+
+func (c *compiler) emit(format string, args ...any) {
+	c.vm = append(c.vm, fmt.Sprintf(format, args...))
+}
+
+func (c *compiler) errorf(node Node, format string, args ...any) {
+	c.diagnostics.Add(lexer.Errorf(node.Pos(), format, args...))
+}
+
+// label returns a label that is unique within the current subroutine.
+func (c *compiler) label(prefix string) string {
+	l := fmt.Sprintf("%s%d", prefix, c.labels)
+	c.labels++
+	return l
+}
+
+func (c *compiler) subroutine(s Subroutine) {
+	c.current = s
+	c.labels = 0
+	c.symbols.Reset()
+	if s.Kind == Method {
+		// The object a method is invoked on is passed as a hidden first argument.
+		_, _ = c.symbols.Define("this", Type(c.class.Name), Argument)
+	}
+	for _, p := range s.Parameters {
+		if _, err := c.symbols.Define(p.Name, p.Type, Argument); err != nil {
+			c.errorf(p, "%v", err)
+		}
+	}
+	for _, l := range s.Locals {
+		for _, name := range l.Names {
+			if _, err := c.symbols.Define(name, l.Type, Local); err != nil {
+				c.errorf(l, "%v", err)
+			}
+		}
+	}
+	c.emit("function %s.%s %d", c.class.Name, s.Name, c.symbols.Count(Local))
+	switch s.Kind {
+	case Constructor:
+		c.emit("push constant %d", c.symbols.Count(Field))
+		c.emit("call Memory.alloc 1")
+		c.emit("pop pointer 0")
+	case Method:
+		c.emit("push argument 0")
+		c.emit("pop pointer 0")
+	}
+	c.statements(s.Statements)
+}
+
+func (c *compiler) statements(stmts []Statement) {
+	for _, stmt := range stmts {
+		c.statement(stmt)
+	}
+}
+
+func (c *compiler) statement(stmt Statement) {
+	switch s := stmt.(type) {
+	case LetStatement:
+		if s.Index == nil {
+			c.expression(s.Value)
+			if symbol, ok := c.variable(s, s.Name); ok {
+				c.emit("pop %s %d", symbol.Segment(), symbol.Index)
+			}
+			return
+		}
+		symbol, ok := c.variable(s, s.Name)
+		if !ok {
+			return
+		}
+		// The value is evaluated before THAT is repointed since the value itself may be read through THAT.
+		c.emit("push %s %d", symbol.Segment(), symbol.Index)
+		c.expression(s.Index)
+		c.emit("add")
+		c.expression(s.Value)
+		c.emit("pop temp 0")
+		c.emit("pop pointer 1")
+		c.emit("push temp 0")
+		c.emit("pop that 0")
+	case IfStatement:
+		otherwise, end := c.label("IF_FALSE"), c.label("IF_END")
+		c.expression(s.Condition)
+		c.emit("not")
+		c.emit("if-goto %s", otherwise)
+		c.statements(s.Then)
+		c.emit("goto %s", end)
+		c.emit("label %s", otherwise)
+		c.statements(s.Else)
+		c.emit("label %s", end)
+	case WhileStatement:
+		loop, end := c.label("WHILE_EXP"), c.label("WHILE_END")
+		c.emit("label %s", loop)
+		c.expression(s.Condition)
+		c.emit("not")
+		c.emit("if-goto %s", end)
+		c.statements(s.Body)
+		c.emit("goto %s", loop)
+		c.emit("label %s", end)
+	case DoStatement:
+		c.call(s.Call)
+		// Every subroutine returns a value, even void ones, which must be discarded.
+		c.emit("pop temp 0")
+	case ReturnStatement:
+		if s.Value == nil {
+			if c.current.ReturnType != Void {
+				c.errorf(s, "subroutine %s must return a value of type %s", c.current.Name, c.current.ReturnType)
+			}
+			c.emit("push constant 0")
+		} else {
+			if c.current.ReturnType == Void {
+				c.errorf(s, "void subroutine %s cannot return a value", c.current.Name)
+			}
+			c.expression(s.Value)
+		}
+		c.emit("return")
+	default:
+		c.errorf(stmt, "unsupported statement %s", stmt.Literal())
+	}
+}
+
+var operations = map[byte]string{
+	'+': "add",
+	'-': "sub",
+	'*': "call Math.multiply 2",
+	'/': "call Math.divide 2",
+	'&': "and",
+	'|': "or",
+	'<': "lt",
+	'>': "gt",
+	'=': "eq",
+}
+
+func (c *compiler) expression(expr Expression) {
+	switch e := expr.(type) {
+	case IntegerConstant:
+		c.emit("push constant %d", e.Value)
+	case StringConstant:
+		c.emit("push constant %d", len(e.Value))
+		c.emit("call String.new 1")
+		for i := range len(e.Value) {
+			c.emit("push constant %d", e.Value[i])
+			c.emit("call String.appendChar 2")
+		}
+	case KeywordConstant:
+		switch e.Keyword {
+		case "true":
+			c.emit("push constant 1")
+			c.emit("neg")
+		case "this":
+			if c.current.Kind == Function {
+				c.errorf(e, "this cannot be referenced from function %s", c.current.Name)
+			}
+			c.emit("push pointer 0")
+		default:
+			c.emit("push constant 0")
+		}
+	case VariableExpression:
+		if symbol, ok := c.variable(e, e.Name); ok {
+			c.emit("push %s %d", symbol.Segment(), symbol.Index)
+		}
+	case IndexExpression:
+		symbol, ok := c.variable(e, e.Name)
+		if !ok {
+			return
+		}
+		c.emit("push %s %d", symbol.Segment(), symbol.Index)
+		c.expression(e.Index)
+		c.emit("add")
+		c.emit("pop pointer 1")
+		c.emit("push that 0")
+	case CallExpression:
+		c.call(e)
+	case UnaryExpression:
+		c.expression(e.Operand)
+		if e.Operator == '-' {
+			c.emit("neg")
+		} else {
+			c.emit("not")
+		}
+	case BinaryExpression:
+		c.expression(e.Left)
+		c.expression(e.Right)
+		c.emit(operations[e.Operator])
+	default:
+		c.errorf(expr, "unsupported expression %s", expr.Literal())
+	}
+}
+
+// call generates a subroutine call. A call without a receiver invokes a method on the current object, a receiver that
+// names a variable invokes a method on the object it references, and any other receiver is taken to be a class name.
+func (c *compiler) call(e CallExpression) {
+	args := len(e.Arguments)
+	var target string
+	if e.Receiver == "" {
+		if c.current.Kind == Function {
+			c.errorf(e, "method %s cannot be called without an object from function %s", e.Name, c.current.Name)
+		}
+		c.emit("push pointer 0")
+		target = fmt.Sprintf("%s.%s", c.class.Name, e.Name)
+		args++
+	} else if symbol, ok := c.symbols.Lookup(e.Receiver); ok {
+		c.reference(e, symbol)
+		if symbol.Type == Int || symbol.Type == Char || symbol.Type == Boolean {
+			c.errorf(e, "method %s cannot be called on %s of primitive type %s", e.Name, symbol.Name, symbol.Type)
+		}
+		c.emit("push %s %d", symbol.Segment(), symbol.Index)
+		target = fmt.Sprintf("%s.%s", symbol.Type, e.Name)
+		args++
+	} else {
+		target = fmt.Sprintf("%s.%s", e.Receiver, e.Name)
+	}
+	for _, arg := range e.Arguments {
+		c.expression(arg)
+	}
+	c.emit("call %s %d", target, args)
+}
+
+// variable looks up the variable called name and reports an error at node if it cannot be used from the current
+// subroutine.
+func (c *compiler) variable(node Node, name string) (Symbol, bool) {
+	symbol, ok := c.symbols.Lookup(name)
+	if !ok {
+		c.errorf(node, "undefined variable %s", name)
+		return Symbol{}, false
+	}
+	return symbol, c.reference(node, symbol)
+}
+
+// reference reports whether symbol may be referenced from the current subroutine, which is not the case for fields
+// referenced from functions as they have no current object.
+func (c *compiler) reference(node Node, symbol Symbol) bool {
+	if symbol.Kind == Field && c.current.Kind == Function {
+		c.errorf(node, "field %s cannot be referenced from function %s", symbol.Name, c.current.Name)
+		return false
+	}
+	return true
+}
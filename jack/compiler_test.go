@@ -0,0 +1,230 @@
+package jack
+
+import (
+	"errors"
+	"github.com/crookdc/nand2tetris/diagnostic"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected []string
+	}{
+		{
+			name: "function with locals and loop",
+			src: `
+			class Main {
+				static int total;
+				function void main() {
+					var int i;
+					let i = 0;
+					while (i < 3) {
+						let total = total + i;
+						let i = i + 1;
+					}
+					return;
+				}
+			}`,
+			expected: []string{
+				"function Main.main 1",
+				"push constant 0",
+				"pop local 0",
+				"label WHILE_EXP0",
+				"push local 0",
+				"push constant 3",
+				"lt",
+				"not",
+				"if-goto WHILE_END1",
+				"push static 0",
+				"push local 0",
+				"add",
+				"pop static 0",
+				"push local 0",
+				"push constant 1",
+				"add",
+				"pop local 0",
+				"goto WHILE_EXP0",
+				"label WHILE_END1",
+				"push constant 0",
+				"return",
+			},
+		},
+		{
+			name: "constructor and methods",
+			src: `
+			class Point {
+				field int x, y;
+				constructor Point new(int ax, int ay) {
+					let x = ax;
+					let y = ay;
+					return this;
+				}
+				method int sum() {
+					return x + y;
+				}
+				method int double() {
+					if (x = y) {
+						return sum() * 2;
+					} else {
+						return -1;
+					}
+				}
+			}`,
+			expected: []string{
+				"function Point.new 0",
+				"push constant 2",
+				"call Memory.alloc 1",
+				"pop pointer 0",
+				"push argument 0",
+				"pop this 0",
+				"push argument 1",
+				"pop this 1",
+				"push pointer 0",
+				"return",
+				"function Point.sum 0",
+				"push argument 0",
+				"pop pointer 0",
+				"push this 0",
+				"push this 1",
+				"add",
+				"return",
+				"function Point.double 0",
+				"push argument 0",
+				"pop pointer 0",
+				"push this 0",
+				"push this 1",
+				"eq",
+				"not",
+				"if-goto IF_FALSE0",
+				"push pointer 0",
+				"call Point.sum 1",
+				"push constant 2",
+				"call Math.multiply 2",
+				"return",
+				"goto IF_END1",
+				"label IF_FALSE0",
+				"push constant 1",
+				"neg",
+				"return",
+				"label IF_END1",
+			},
+		},
+		{
+			name: "arrays, strings and calls",
+			src: `
+			class Main {
+				function void main() {
+					var Array a;
+					var Point p;
+					let a = Array.new(2);
+					let a[1] = a[0];
+					let p = Point.new(1, 2);
+					do Output.printString("Hi");
+					do Output.printInt(p.sum());
+					return;
+				}
+			}`,
+			expected: []string{
+				"function Main.main 2",
+				"push constant 2",
+				"call Array.new 1",
+				"pop local 0",
+				"push local 0",
+				"push constant 1",
+				"add",
+				"push local 0",
+				"push constant 0",
+				"add",
+				"pop pointer 1",
+				"push that 0",
+				"pop temp 0",
+				"pop pointer 1",
+				"push temp 0",
+				"pop that 0",
+				"push constant 1",
+				"push constant 2",
+				"call Point.new 2",
+				"pop local 1",
+				"push constant 2",
+				"call String.new 1",
+				"push constant 72",
+				"call String.appendChar 2",
+				"push constant 105",
+				"call String.appendChar 2",
+				"call Output.printString 1",
+				"pop temp 0",
+				"push local 1",
+				"call Point.sum 1",
+				"call Output.printInt 1",
+				"pop temp 0",
+				"push constant 0",
+				"return",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parser := NewParser(LoadedLexer(test.src))
+			class, err := parser.Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, err := Compile(class)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("expected\n%s\nbut got\n%s", strings.Join(test.expected, "\n"), strings.Join(actual, "\n"))
+			}
+		})
+	}
+}
+
+func TestCompile_errors(t *testing.T) {
+	src := `class Main {
+	field int x;
+	function void main() {
+		var int i, i;
+		let y = 1;
+		let x = this;
+		do run();
+		do i.run();
+		return 1;
+	}
+	method int f() {
+		return;
+	}
+}`
+	parser := NewParser(LoadedFileLexer("Main.jack", src))
+	class, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Compile(class)
+	var list diagnostic.List
+	if !errors.As(err, &list) {
+		t.Fatalf("expected a diagnostic list but got %v", err)
+	}
+	expected := []string{
+		"Main.jack:4:3: variable i is already defined",
+		"Main.jack:5:3: undefined variable y",
+		"Main.jack:6:11: this cannot be referenced from function main",
+		"Main.jack:6:3: field x cannot be referenced from function main",
+		"Main.jack:7:6: method run cannot be called without an object from function main",
+		"Main.jack:8:6: method run cannot be called on i of primitive type int",
+		"Main.jack:9:3: void subroutine main cannot return a value",
+		"Main.jack:12:3: subroutine f must return a value of type int",
+	}
+	if len(list) != len(expected) {
+		t.Fatalf("expected %d diagnostics but got %d:\n%v", len(expected), len(list), list)
+	}
+	for i := range expected {
+		if list[i].Error() != expected[i] {
+			t.Errorf("expected %q but got %q", expected[i], list[i].Error())
+		}
+	}
+}
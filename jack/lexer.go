@@ -0,0 +1,158 @@
+package jack
+
+import (
+	"fmt"
+	"github.com/crookdc/nand2tetris/lexer"
+)
+
+var (
+	symbols = map[uint8]variant{
+		'{': leftCurlyBrace,
+		'}': rightCurlyBrace,
+		'(': leftParenthesis,
+		')': rightParenthesis,
+		'[': leftBracket,
+		']': rightBracket,
+		'.': dot,
+		',': comma,
+		';': semicolon,
+		'+': plus,
+		'-': minus,
+		'*': asterisk,
+		'/': slash,
+		'&': ampersand,
+		'|': pipe,
+		'<': lessThan,
+		'>': greaterThan,
+		'=': equals,
+		'~': tilde,
+	}
+	keywords = map[string]variant{
+		"class":       class,
+		"constructor": constructor,
+		"function":    function,
+		"method":      method,
+		"field":       field,
+		"static":      static,
+		"var":         var_,
+		"int":         int_,
+		"char":        char,
+		"boolean":     boolean,
+		"void":        void,
+		"true":        true_,
+		"false":       false_,
+		"null":        null,
+		"this":        this,
+		"let":         let,
+		"do":          do,
+		"if":          if_,
+		"else":        else_,
+		"while":       while,
+		"return":      return_,
+	}
+)
+
+const (
+	class variant = iota
+	constructor
+	function
+	method
+	field
+	static
+	var_
+	int_
+	char
+	boolean
+	void
+	true_
+	false_
+	null
+	this
+	let
+	do
+	if_
+	else_
+	while
+	return_
+	leftCurlyBrace
+	rightCurlyBrace
+	leftParenthesis
+	rightParenthesis
+	leftBracket
+	rightBracket
+	dot
+	comma
+	semicolon
+	plus
+	minus
+	asterisk
+	slash
+	ampersand
+	pipe
+	lessThan
+	greaterThan
+	equals
+	tilde
+	identifier
+	integer
+	str
+)
+
+type variant int
+
+func (v variant) String() string {
+	switch v {
+	case identifier:
+		return "identifier"
+	case integer:
+		return "integer constant"
+	case str:
+		return "string constant"
+	}
+	for c, symbol := range symbols {
+		if symbol == v {
+			return fmt.Sprintf("'%c'", c)
+		}
+	}
+	for keyword, kw := range keywords {
+		if kw == v {
+			return fmt.Sprintf("'%s'", keyword)
+		}
+	}
+	return fmt.Sprintf("variant(%d)", int(v))
+}
+
+// NewLexer constructs a lexer for the Jack language. Line comments, block comments and documentation comments are all
+// ignored by the lexer.
+func NewLexer() *lexer.Lexer[variant] {
+	word := lexer.Any(lexer.Alphanumeric, lexer.Equals[variant]('_'))
+	return lexer.NewLexer[variant](
+		lexer.Params[variant]{
+			Symbols: symbols,
+			Ignore: lexer.Any(
+				lexer.Whitespace[variant],
+				lexer.LineComment[variant]("//"),
+				lexer.BlockComment[variant]("/*", "*/"),
+			),
+		},
+		lexer.StringLiteral[variant](str),
+		lexer.Integer[variant](integer),
+		// Keywords are matched using the same condition as identifiers so that identifiers that merely begin with a
+		// keyword, such as classification, are not mistaken for keywords.
+		lexer.Keywords[variant](keywords, word),
+		lexer.Condition[variant](identifier, word),
+	)
+}
+
+func LoadedLexer(src string) *lexer.Lexer[variant] {
+	l := NewLexer()
+	l.Load(src)
+	return l
+}
+
+// LoadedFileLexer works like LoadedLexer but attributes every token to the named file.
+func LoadedFileLexer(file string, src string) *lexer.Lexer[variant] {
+	l := NewLexer()
+	l.LoadFile(file, src)
+	return l
+}
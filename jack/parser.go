@@ -0,0 +1,651 @@
+package jack
+
+import (
+	"errors"
+	"github.com/crookdc/nand2tetris/diagnostic"
+	"github.com/crookdc/nand2tetris/lexer"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+)
+
+// ParseFile parses the Jack class defined in the named file.
+func ParseFile(filename string) (Class, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return Class{}, err
+	}
+	p := NewParser(LoadedFileLexer(filename, string(src)))
+	return p.Parse()
+}
+
+// Files returns the Jack file at path, or every .jack file in it if path is a directory.
+func Files(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".jack" {
+			continue
+		}
+		files = append(files, filepath.Join(path, entry.Name()))
+	}
+	return files, nil
+}
+
+func NewParser(lexer *lexer.Lexer[variant]) Parser {
+	return Parser{
+		lexer: lexer,
+	}
+}
+
+// Parser is a recursive descent parser for the Jack language.
+type Parser struct {
+	lexer       *lexer.Lexer[variant]
+	diagnostics diagnostic.List
+}
+
+// Parse reads the single class that makes up a Jack source file. Parsing does not stop at the first problem, the parser
+// instead resumes at the next statement or subroutine such that the returned error is a diagnostic.List covering every
+// problem in the source. The returned class contains whatever could be parsed.
+func (p *Parser) Parse() (Class, error) {
+	p.diagnostics = nil
+	c, err := p.parseClass()
+	if err != nil {
+		p.diagnostics.Add(err)
+	} else if tok, err := p.lexer.Next(); !errors.Is(err, io.EOF) {
+		if err != nil {
+			p.diagnostics.Add(err)
+		} else {
+			p.diagnostics.Add(lexer.TokenErrorf(tok, "unexpected %s after end of class", describe(tok)))
+		}
+	}
+	return c, p.diagnostics.Err()
+}
+
+func (p *Parser) parseClass() (Class, error) {
+	start, err := p.expect(class)
+	if err != nil {
+		return Class{}, err
+	}
+	name, err := p.expect(identifier)
+	if err != nil {
+		return Class{}, err
+	}
+	c := Class{
+		Name:        name.Literal,
+		Variables:   make([]ClassVariable, 0),
+		Subroutines: make([]Subroutine, 0),
+		Position:    start.Position,
+	}
+	if _, err := p.expect(leftCurlyBrace); err != nil {
+		return c, err
+	}
+	for p.peek(static, field) {
+		v, err := p.parseClassVariable()
+		if err != nil {
+			p.diagnostics.Add(err)
+			p.synchronize(static, field, constructor, function, method, rightCurlyBrace)
+			continue
+		}
+		c.Variables = append(c.Variables, v)
+	}
+	for p.peek(constructor, function, method) {
+		s, err := p.parseSubroutine()
+		if err != nil {
+			p.diagnostics.Add(err)
+			p.synchronizeSubroutine(0)
+			continue
+		}
+		c.Subroutines = append(c.Subroutines, s)
+	}
+	if _, err := p.expect(rightCurlyBrace); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+func (p *Parser) parseClassVariable() (ClassVariable, error) {
+	tok, err := p.lexer.Next()
+	if err != nil {
+		return ClassVariable{}, err
+	}
+	kind := Static
+	if tok.Variant == field {
+		kind = Field
+	}
+	typ, err := p.parseType()
+	if err != nil {
+		return ClassVariable{}, err
+	}
+	names, err := p.parseNames()
+	if err != nil {
+		return ClassVariable{}, err
+	}
+	return ClassVariable{
+		Kind:     kind,
+		Type:     typ,
+		Names:    names,
+		Position: tok.Position,
+	}, nil
+}
+
+// parseNames reads a comma-separated list of identifiers terminated by a semicolon.
+func (p *Parser) parseNames() ([]string, error) {
+	names := make([]string, 0)
+	for {
+		name, err := p.expect(identifier)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name.Literal)
+		if !p.peek(comma) {
+			break
+		}
+		_, _ = p.lexer.Next()
+	}
+	if _, err := p.expect(semicolon); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func (p *Parser) parseType() (Type, error) {
+	tok, err := p.lexer.Next()
+	if err != nil {
+		return "", p.eof(err)
+	}
+	switch tok.Variant {
+	case int_, char, boolean, identifier:
+		return Type(tok.Literal), nil
+	default:
+		return "", lexer.TokenErrorf(tok, "expected type but found %s", describe(tok))
+	}
+}
+
+func (p *Parser) parseSubroutine() (Subroutine, error) {
+	tok, err := p.lexer.Next()
+	if err != nil {
+		return Subroutine{}, err
+	}
+	s := Subroutine{
+		Parameters: make([]Parameter, 0),
+		Locals:     make([]LocalVariable, 0),
+		Position:   tok.Position,
+	}
+	switch tok.Variant {
+	case constructor:
+		s.Kind = Constructor
+	case function:
+		s.Kind = Function
+	default:
+		s.Kind = Method
+	}
+	if p.peek(void) {
+		_, _ = p.lexer.Next()
+		s.ReturnType = Void
+	} else if s.ReturnType, err = p.parseType(); err != nil {
+		return Subroutine{}, err
+	}
+	name, err := p.expect(identifier)
+	if err != nil {
+		return Subroutine{}, err
+	}
+	s.Name = name.Literal
+	if _, err := p.expect(leftParenthesis); err != nil {
+		return Subroutine{}, err
+	}
+	for !p.peek(rightParenthesis) {
+		if len(s.Parameters) > 0 {
+			if _, err := p.expect(comma); err != nil {
+				return Subroutine{}, err
+			}
+		}
+		typ, err := p.parseType()
+		if err != nil {
+			return Subroutine{}, err
+		}
+		name, err := p.expect(identifier)
+		if err != nil {
+			return Subroutine{}, err
+		}
+		s.Parameters = append(s.Parameters, Parameter{
+			Type:     typ,
+			Name:     name.Literal,
+			Position: name.Position,
+		})
+	}
+	if _, err := p.expect(rightParenthesis); err != nil {
+		return Subroutine{}, err
+	}
+	if _, err := p.expect(leftCurlyBrace); err != nil {
+		return Subroutine{}, err
+	}
+	for p.peek(var_) {
+		local, err := p.parseLocalVariable()
+		if err != nil {
+			p.diagnostics.Add(err)
+			p.synchronize(var_, let, do, if_, while, return_, rightCurlyBrace)
+			continue
+		}
+		s.Locals = append(s.Locals, local)
+	}
+	s.Statements = p.parseStatements()
+	if _, err := p.expect(rightCurlyBrace); err != nil {
+		// The body has been entered so it is skipped up to and including its closing brace, leaving the class to carry
+		// on with the next subroutine.
+		p.diagnostics.Add(err)
+		p.synchronizeSubroutine(1)
+	}
+	return s, nil
+}
+
+func (p *Parser) parseLocalVariable() (LocalVariable, error) {
+	start, err := p.lexer.Next()
+	if err != nil {
+		return LocalVariable{}, err
+	}
+	typ, err := p.parseType()
+	if err != nil {
+		return LocalVariable{}, err
+	}
+	names, err := p.parseNames()
+	if err != nil {
+		return LocalVariable{}, err
+	}
+	return LocalVariable{
+		Type:     typ,
+		Names:    names,
+		Position: start.Position,
+	}, nil
+}
+
+// parseStatements reads statements until a token that cannot begin a statement is found. Malformed statements are
+// reported and skipped rather than aborting the enclosing block.
+func (p *Parser) parseStatements() []Statement {
+	stmts := make([]Statement, 0)
+	for p.peek(let, do, if_, while, return_) {
+		stmt, err := p.parseStatement()
+		if err != nil {
+			p.diagnostics.Add(err)
+			p.synchronize(let, do, if_, while, return_, rightCurlyBrace, constructor, function, method)
+			continue
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
+
+func (p *Parser) parseStatement() (Statement, error) {
+	tok, err := p.lexer.Next()
+	if err != nil {
+		return nil, err
+	}
+	switch tok.Variant {
+	case let:
+		return p.parseLetStatement(tok)
+	case if_:
+		return p.parseIfStatement(tok)
+	case while:
+		return p.parseWhileStatement(tok)
+	case do:
+		return p.parseDoStatement(tok)
+	case return_:
+		return p.parseReturnStatement(tok)
+	default:
+		return nil, lexer.TokenErrorf(tok, "expected statement but found %s", describe(tok))
+	}
+}
+
+func (p *Parser) parseLetStatement(start lexer.Token[variant]) (LetStatement, error) {
+	name, err := p.expect(identifier)
+	if err != nil {
+		return LetStatement{}, err
+	}
+	stmt := LetStatement{
+		Name:     name.Literal,
+		Position: start.Position,
+	}
+	if p.peek(leftBracket) {
+		_, _ = p.lexer.Next()
+		if stmt.Index, err = p.parseExpression(); err != nil {
+			return LetStatement{}, err
+		}
+		if _, err := p.expect(rightBracket); err != nil {
+			return LetStatement{}, err
+		}
+	}
+	if _, err := p.expect(equals); err != nil {
+		return LetStatement{}, err
+	}
+	if stmt.Value, err = p.parseExpression(); err != nil {
+		return LetStatement{}, err
+	}
+	if _, err := p.expect(semicolon); err != nil {
+		return LetStatement{}, err
+	}
+	return stmt, nil
+}
+
+func (p *Parser) parseIfStatement(start lexer.Token[variant]) (IfStatement, error) {
+	condition, err := p.parseCondition()
+	if err != nil {
+		return IfStatement{}, err
+	}
+	then, err := p.parseBlock()
+	if err != nil {
+		return IfStatement{}, err
+	}
+	stmt := IfStatement{
+		Condition: condition,
+		Then:      then,
+		Position:  start.Position,
+	}
+	if p.peek(else_) {
+		_, _ = p.lexer.Next()
+		if stmt.Else, err = p.parseBlock(); err != nil {
+			return IfStatement{}, err
+		}
+	}
+	return stmt, nil
+}
+
+func (p *Parser) parseWhileStatement(start lexer.Token[variant]) (WhileStatement, error) {
+	condition, err := p.parseCondition()
+	if err != nil {
+		return WhileStatement{}, err
+	}
+	body, err := p.parseBlock()
+	if err != nil {
+		return WhileStatement{}, err
+	}
+	return WhileStatement{
+		Condition: condition,
+		Body:      body,
+		Position:  start.Position,
+	}, nil
+}
+
+// parseCondition reads an expression wrapped in parentheses as found after the if and while keywords.
+func (p *Parser) parseCondition() (Expression, error) {
+	if _, err := p.expect(leftParenthesis); err != nil {
+		return nil, err
+	}
+	condition, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(rightParenthesis); err != nil {
+		return nil, err
+	}
+	return condition, nil
+}
+
+// parseBlock reads statements wrapped in curly braces.
+func (p *Parser) parseBlock() ([]Statement, error) {
+	if _, err := p.expect(leftCurlyBrace); err != nil {
+		return nil, err
+	}
+	stmts := p.parseStatements()
+	if _, err := p.expect(rightCurlyBrace); err != nil {
+		return nil, err
+	}
+	return stmts, nil
+}
+
+func (p *Parser) parseDoStatement(start lexer.Token[variant]) (DoStatement, error) {
+	name, err := p.expect(identifier)
+	if err != nil {
+		return DoStatement{}, err
+	}
+	call, err := p.parseCallExpression(name)
+	if err != nil {
+		return DoStatement{}, err
+	}
+	if _, err := p.expect(semicolon); err != nil {
+		return DoStatement{}, err
+	}
+	return DoStatement{
+		Call:     call,
+		Position: start.Position,
+	}, nil
+}
+
+func (p *Parser) parseReturnStatement(start lexer.Token[variant]) (ReturnStatement, error) {
+	stmt := ReturnStatement{Position: start.Position}
+	if !p.peek(semicolon) {
+		value, err := p.parseExpression()
+		if err != nil {
+			return ReturnStatement{}, err
+		}
+		stmt.Value = value
+	}
+	if _, err := p.expect(semicolon); err != nil {
+		return ReturnStatement{}, err
+	}
+	return stmt, nil
+}
+
+var operators = []variant{plus, minus, asterisk, slash, ampersand, pipe, lessThan, greaterThan, equals}
+
+func (p *Parser) parseExpression() (Expression, error) {
+	expr, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek(operators...) {
+		op, _ := p.lexer.Next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		expr = BinaryExpression{
+			Operator: op.Literal[0],
+			Left:     expr,
+			Right:    right,
+			Position: op.Position,
+		}
+	}
+	return expr, nil
+}
+
+func (p *Parser) parseTerm() (Expression, error) {
+	tok, err := p.lexer.Next()
+	if err != nil {
+		return nil, p.eof(err)
+	}
+	switch tok.Variant {
+	case integer:
+		n, err := strconv.Atoi(tok.Literal)
+		if err != nil || n > 32767 {
+			return nil, lexer.TokenErrorf(tok, "integer constant %s is out of range, must be between 0 and 32767", tok.Literal)
+		}
+		return IntegerConstant{Value: n, Position: tok.Position}, nil
+	case str:
+		return StringConstant{Value: tok.Literal, Position: tok.Position}, nil
+	case true_, false_, null, this:
+		return KeywordConstant{Keyword: tok.Literal, Position: tok.Position}, nil
+	case minus, tilde:
+		operand, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		return UnaryExpression{
+			Operator: tok.Literal[0],
+			Operand:  operand,
+			Position: tok.Position,
+		}, nil
+	case leftParenthesis:
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(rightParenthesis); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	case identifier:
+		switch {
+		case p.peek(leftBracket):
+			_, _ = p.lexer.Next()
+			index, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(rightBracket); err != nil {
+				return nil, err
+			}
+			return IndexExpression{
+				Name:     tok.Literal,
+				Index:    index,
+				Position: tok.Position,
+			}, nil
+		case p.peek(leftParenthesis, dot):
+			return p.parseCallExpression(tok)
+		default:
+			return VariableExpression{Name: tok.Literal, Position: tok.Position}, nil
+		}
+	default:
+		return nil, lexer.TokenErrorf(tok, "expected expression but found %s", describe(tok))
+	}
+}
+
+// parseCallExpression reads the remainder of a subroutine call where name is the first identifier of the call, which
+// is either the subroutine name itself or the receiver of the call.
+func (p *Parser) parseCallExpression(name lexer.Token[variant]) (CallExpression, error) {
+	call := CallExpression{
+		Name:      name.Literal,
+		Arguments: make([]Expression, 0),
+		Position:  name.Position,
+	}
+	if p.peek(dot) {
+		_, _ = p.lexer.Next()
+		sub, err := p.expect(identifier)
+		if err != nil {
+			return CallExpression{}, err
+		}
+		call.Receiver = name.Literal
+		call.Name = sub.Literal
+	}
+	if _, err := p.expect(leftParenthesis); err != nil {
+		return CallExpression{}, err
+	}
+	for !p.peek(rightParenthesis) {
+		if len(call.Arguments) > 0 {
+			if _, err := p.expect(comma); err != nil {
+				return CallExpression{}, err
+			}
+		}
+		arg, err := p.parseExpression()
+		if err != nil {
+			return CallExpression{}, err
+		}
+		call.Arguments = append(call.Arguments, arg)
+	}
+	if _, err := p.expect(rightParenthesis); err != nil {
+		return CallExpression{}, err
+	}
+	return call, nil
+}
+
+// peek reports whether the next token is of any of the provided variants without consuming it.
+func (p *Parser) peek(variants ...variant) bool {
+	tok, err := p.lexer.Peek()
+	if err != nil {
+		return false
+	}
+	return slices.Contains(variants, tok.Variant)
+}
+
+// expect consumes the next token if it is of variant v and returns an error otherwise. A mismatching token is left in
+// place which allows the parser to resynchronize on it.
+func (p *Parser) expect(v variant) (lexer.Token[variant], error) {
+	tok, err := p.lexer.Peek()
+	if err != nil {
+		return lexer.Token[variant]{}, p.eof(err)
+	}
+	if tok.Variant != v {
+		return lexer.Token[variant]{}, lexer.TokenErrorf(tok, "expected %s but found %s", v, describe(tok))
+	}
+	return p.lexer.Next()
+}
+
+// eof turns a plain io.EOF into a positioned error since running out of tokens is always unexpected when the parser
+// asks for more.
+func (p *Parser) eof(err error) error {
+	if errors.Is(err, io.EOF) {
+		return lexer.Errorf(p.lexer.Position(), "unexpected end of file")
+	}
+	return err
+}
+
+// synchronize discards tokens until the next token is of one of the provided variants or the source is exhausted.
+func (p *Parser) synchronize(variants ...variant) {
+	for {
+		tok, err := p.lexer.Peek()
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			// The lexer cannot make sense of the source at the cursor so everything up to the next whitespace is skipped.
+			p.lexer.Skip()
+			_ = p.lexer.Seek(lexer.Whitespace[variant])
+			continue
+		}
+		if slices.Contains(variants, tok.Variant) {
+			return
+		}
+		_, _ = p.lexer.Next()
+	}
+}
+
+// synchronizeSubroutine discards tokens until the beginning of the next subroutine or the end of the class. Curly braces
+// are balanced along the way, depth being the number of braces already opened, such that the body of a malformed
+// subroutine is skipped as a whole.
+func (p *Parser) synchronizeSubroutine(depth int) {
+	for {
+		tok, err := p.lexer.Peek()
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			p.lexer.Skip()
+			_ = p.lexer.Seek(lexer.Whitespace[variant])
+			continue
+		}
+		switch tok.Variant {
+		case leftCurlyBrace:
+			depth++
+		case rightCurlyBrace:
+			if depth == 0 {
+				return
+			}
+			depth--
+		case constructor, function, method:
+			// These cannot appear within a body, so a subroutine begins here even if a brace was left unclosed.
+			return
+		}
+		_, _ = p.lexer.Next()
+	}
+}
+
+// describe returns a human-readable description of tok for use in error messages.
+func describe(tok lexer.Token[variant]) string {
+	switch tok.Variant {
+	case identifier, integer, str:
+		return tok.Variant.String() + " '" + tok.Literal + "'"
+	default:
+		return tok.Variant.String()
+	}
+}
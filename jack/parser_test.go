@@ -0,0 +1,265 @@
+package jack
+
+import (
+	"errors"
+	"github.com/crookdc/nand2tetris/diagnostic"
+	"github.com/crookdc/nand2tetris/lexer"
+	"reflect"
+	"testing"
+)
+
+func TestLexer(t *testing.T) {
+	src := `/** Documentation
+ * spanning lines */
+class classification { // trailing
+	/* block */ field int x1;
+	let s = "hi there"; 32767 ~x
+}`
+	expected := []lexer.Token[variant]{
+		{Variant: class, Literal: "class", Position: lexer.Position{Line: 3, Column: 1, Offset: 39}},
+		{Variant: identifier, Literal: "classification", Position: lexer.Position{Line: 3, Column: 7, Offset: 45}},
+		{Variant: leftCurlyBrace, Literal: "{", Position: lexer.Position{Line: 3, Column: 22, Offset: 60}},
+		{Variant: field, Literal: "field", Position: lexer.Position{Line: 4, Column: 14, Offset: 87}},
+		{Variant: int_, Literal: "int", Position: lexer.Position{Line: 4, Column: 20, Offset: 93}},
+		{Variant: identifier, Literal: "x1", Position: lexer.Position{Line: 4, Column: 24, Offset: 97}},
+		{Variant: semicolon, Literal: ";", Position: lexer.Position{Line: 4, Column: 26, Offset: 99}},
+		{Variant: let, Literal: "let", Position: lexer.Position{Line: 5, Column: 2, Offset: 102}},
+		{Variant: identifier, Literal: "s", Position: lexer.Position{Line: 5, Column: 6, Offset: 106}},
+		{Variant: equals, Literal: "=", Position: lexer.Position{Line: 5, Column: 8, Offset: 108}},
+		{Variant: str, Literal: "hi there", Position: lexer.Position{Line: 5, Column: 10, Offset: 110}},
+		{Variant: semicolon, Literal: ";", Position: lexer.Position{Line: 5, Column: 20, Offset: 120}},
+		{Variant: integer, Literal: "32767", Position: lexer.Position{Line: 5, Column: 22, Offset: 122}},
+		{Variant: tilde, Literal: "~", Position: lexer.Position{Line: 5, Column: 28, Offset: 128}},
+		{Variant: identifier, Literal: "x", Position: lexer.Position{Line: 5, Column: 29, Offset: 129}},
+		{Variant: rightCurlyBrace, Literal: "}", Position: lexer.Position{Line: 6, Column: 1, Offset: 131}},
+	}
+	lx := LoadedLexer(src)
+	for _, token := range expected {
+		actual, err := lx.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual.Variant != token.Variant || actual.Literal != token.Literal || actual.Position != token.Position {
+			t.Errorf("expected %+v but got %+v", token, actual)
+		}
+		if actual.Variant == str {
+			// The quotes are part of the token even though they are not part of its literal.
+			if end := actual.End(); end.Column != 20 || end.Offset != 120 {
+				t.Errorf("expected string literal to end at 5:20 but got %s", end)
+			}
+		}
+	}
+	if tok, err := lx.Next(); err == nil {
+		t.Errorf("expected end of input but got %+v", tok)
+	}
+}
+
+func TestParser_Parse(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{
+			src:      `class Main { }`,
+			expected: `class Main {  }`,
+		},
+		{
+			src: `
+			class Point {
+				field int x, y;
+				static Point origin;
+
+				constructor Point new(int ax, int ay) {
+					let x = ax;
+					let y = ay;
+					return this;
+				}
+
+				method int distance(Point other) {
+					var int dx, dy;
+					let dx = x - other.getX();
+					let dy = y - other.getY();
+					return Math.sqrt((dx * dx) + (dy * dy));
+				}
+			}`,
+			expected: `class Point { field int x, y; static Point origin; ` +
+				`constructor Point new(int ax, int ay) { let x = ax; let y = ay; return this; } ` +
+				`method int distance(Point other) { var int dx, dy; let dx = (x - other.getX()); ` +
+				`let dy = (y - other.getY()); return Math.sqrt(((dx * dx) + (dy * dy))); } }`,
+		},
+		{
+			src: `
+			class Main {
+				function void main() {
+					var Array a;
+					var String s;
+					let a = Array.new(3);
+					let a[a[0] + 1] = -a[2] * ~false;
+					let s = "hello";
+					if (a[1] < 2 & true) {
+						do Output.printString(s);
+					} else {
+						while (~(a[0] = null)) { do run(); }
+					}
+					do Output.println();
+					return;
+				}
+			}`,
+			expected: `class Main { function void main() { var Array a; var String s; let a = Array.new(3); ` +
+				`let a[(a[0] + 1)] = (-a[2] * ~false); let s = "hello"; ` +
+				`if (((a[1] < 2) & true)) { do Output.printString(s); } else { while (~(a[0] = null)) { do run(); } } ` +
+				`do Output.println(); return; } }`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			parser := NewParser(LoadedLexer(test.src))
+			c, err := parser.Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Literal() != test.expected {
+				t.Errorf("expected %s but got %s", test.expected, c.Literal())
+			}
+		})
+	}
+}
+
+func TestParser_Parse_tree(t *testing.T) {
+	src := "class A {\n\tfunction int f(int n) {\n\t\treturn 1 + n * 2;\n\t}\n}"
+	parser := NewParser(LoadedLexer(src))
+	c, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ReturnStatement{
+		Value: BinaryExpression{
+			Operator: '*',
+			Left: BinaryExpression{
+				Operator: '+',
+				Left:     IntegerConstant{Value: 1, Position: lexer.Position{Line: 3, Column: 10, Offset: 44}},
+				Right:    VariableExpression{Name: "n", Position: lexer.Position{Line: 3, Column: 14, Offset: 48}},
+				Position: lexer.Position{Line: 3, Column: 12, Offset: 46},
+			},
+			Right:    IntegerConstant{Value: 2, Position: lexer.Position{Line: 3, Column: 18, Offset: 52}},
+			Position: lexer.Position{Line: 3, Column: 16, Offset: 50},
+		},
+		Position: lexer.Position{Line: 3, Column: 3, Offset: 37},
+	}
+	if actual := c.Subroutines[0].Statements[0]; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v but got %+v", expected, actual)
+	}
+}
+
+func TestParser_Parse_recovery(t *testing.T) {
+	src := `class Main {
+	field int;
+	function void main() {
+		var int x
+		let x = 1
+		let y = 2;
+		do Output.printInt(x +);
+		while (true) { let = 3; }
+		return;
+	}
+	method void (int a) {
+		return;
+	}
+	function int f() {
+		return 40000;
+	}
+}`
+	parser := NewParser(LoadedFileLexer("Main.jack", src))
+	c, err := parser.Parse()
+	var list diagnostic.List
+	if !errors.As(err, &list) {
+		t.Fatalf("expected a diagnostic list but got %v", err)
+	}
+	expected := []string{
+		"Main.jack:2:11: expected identifier but found ';'",
+		"Main.jack:5:3: expected ';' but found 'let'",
+		"Main.jack:6:3: expected ';' but found 'let'",
+		"Main.jack:7:25: expected expression but found ')'",
+		"Main.jack:8:22: expected identifier but found '='",
+		"Main.jack:11:14: expected identifier but found '('",
+		"Main.jack:15:10: integer constant 40000 is out of range, must be between 0 and 32767",
+	}
+	if len(list) != len(expected) {
+		t.Fatalf("expected %d diagnostics but got %d:\n%v", len(expected), len(list), list)
+	}
+	for i := range expected {
+		if list[i].Error() != expected[i] {
+			t.Errorf("expected %q but got %q", expected[i], list[i].Error())
+		}
+	}
+	if len(c.Subroutines) != 2 {
+		t.Errorf("expected 2 subroutines to be recovered but got %d", len(c.Subroutines))
+	}
+}
+
+func TestParser_Parse_unlexable(t *testing.T) {
+	tests := []struct {
+		src         string
+		expected    string
+		subroutines int
+	}{
+		{
+			src:         `class A { function void f() { let x = 1 # 2; return; } }`,
+			expected:    "A.jack:1:41: all delegates failed to process character '#'",
+			subroutines: 1,
+		},
+		{
+			src:         `class A { method void #f() { return; } function void g() { return; } }`,
+			expected:    "A.jack:1:23: all delegates failed to process character '#'",
+			subroutines: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			parser := NewParser(LoadedFileLexer("A.jack", test.src))
+			c, err := parser.Parse()
+			var list diagnostic.List
+			if !errors.As(err, &list) {
+				t.Fatalf("expected a diagnostic list but got %v", err)
+			}
+			if list[0].Error() != test.expected {
+				t.Errorf("expected %q but got %q", test.expected, list[0].Error())
+			}
+			if len(c.Subroutines) != test.subroutines {
+				t.Errorf("expected %d subroutines to be recovered but got %d", test.subroutines, len(c.Subroutines))
+			}
+		})
+	}
+}
+
+func TestParser_Parse_bodyRecovery(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{
+			src:      `class Main { function void a() { var int x; foo; return; } function void b() { return; } }`,
+			expected: "Main.jack:1:45: expected '}' but found identifier 'foo'",
+		},
+		{
+			src:      `class Main { function void a() { lett x = 1; return; } function void b() { return; } }`,
+			expected: "Main.jack:1:34: expected '}' but found identifier 'lett'",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			parser := NewParser(LoadedFileLexer("Main.jack", test.src))
+			c, err := parser.Parse()
+			var list diagnostic.List
+			if !errors.As(err, &list) {
+				t.Fatalf("expected a diagnostic list but got %v", err)
+			}
+			if len(list) != 1 || list[0].Error() != test.expected {
+				t.Errorf("expected the single diagnostic %q but got %v", test.expected, list)
+			}
+			if len(c.Subroutines) != 2 || c.Subroutines[1].Name != "b" {
+				t.Errorf("expected the subroutine following the error to be parsed but got %d subroutines", len(c.Subroutines))
+			}
+		})
+	}
+}
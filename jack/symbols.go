@@ -0,0 +1,85 @@
+package jack
+
+import "fmt"
+
+// Symbol is a named variable along with the kind of variable it is and its index within the memory segment of that
+// kind.
+type Symbol struct {
+	Name  string
+	Type  Type
+	Kind  VariableKind
+	Index int
+}
+
+// Segment returns the VM memory segment that holds the variable.
+func (s Symbol) Segment() string {
+	switch s.Kind {
+	case Static:
+		return "static"
+	case Field:
+		return "this"
+	case Argument:
+		return "argument"
+	default:
+		return "local"
+	}
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{
+		class:      make(map[string]Symbol),
+		subroutine: make(map[string]Symbol),
+		counts:     make(map[VariableKind]int),
+	}
+}
+
+// SymbolTable keeps track of the variables in scope while compiling a class. Static and field variables belong to the
+// class scope while argument and local variables belong to the scope of the subroutine currently being compiled, which
+// shadows the class scope.
+type SymbolTable struct {
+	class      map[string]Symbol
+	subroutine map[string]Symbol
+	counts     map[VariableKind]int
+}
+
+// Reset discards the current subroutine scope in preparation for compiling the next subroutine.
+func (s *SymbolTable) Reset() {
+	s.subroutine = make(map[string]Symbol)
+	s.counts[Argument] = 0
+	s.counts[Local] = 0
+}
+
+// Define adds a variable to the scope that corresponds to kind and assigns it the next free index of that kind. It is
+// an error to define the same name twice within a scope.
+func (s *SymbolTable) Define(name string, typ Type, kind VariableKind) (Symbol, error) {
+	scope := s.subroutine
+	if kind == Static || kind == Field {
+		scope = s.class
+	}
+	if _, ok := scope[name]; ok {
+		return Symbol{}, fmt.Errorf("variable %s is already defined", name)
+	}
+	symbol := Symbol{
+		Name:  name,
+		Type:  typ,
+		Kind:  kind,
+		Index: s.counts[kind],
+	}
+	scope[name] = symbol
+	s.counts[kind]++
+	return symbol, nil
+}
+
+// Lookup finds the variable called name, giving precedence to the subroutine scope.
+func (s *SymbolTable) Lookup(name string) (Symbol, bool) {
+	if symbol, ok := s.subroutine[name]; ok {
+		return symbol, true
+	}
+	symbol, ok := s.class[name]
+	return symbol, ok
+}
+
+// Count returns the number of variables of the given kind that are currently defined.
+func (s *SymbolTable) Count(kind VariableKind) int {
+	return s.counts[kind]
+}
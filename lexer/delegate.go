@@ -1,21 +1,17 @@
 package lexer
 
+import "strings"
+
 // LineComment produces a Func delegate that can be used to process line comments. A line comment is defined as a
 // comment that starts with the character sequence provided in start and that stretches until the next linefeed
 // character.
 func LineComment[T comparable](start string) ConditionFunc[T] {
 	return func(l *Lexer[T], c uint8) bool {
-		previous := l.cursor
-		for i := range start {
-			if start[i] != c {
-				// The tokens at the current position did not match the identifier for starting a line comment, so
-				// rewind the cursor and return.
-				l.cursor = previous
-				return false
-			}
-			l.cursor++
-			c = l.source[l.cursor]
+		if !strings.HasPrefix(l.source[l.cursor:], start) {
+			// The bytes at the current position did not match the identifier for starting a line comment.
+			return false
 		}
+		l.cursor += len(start)
 		if err := l.Seek(Equals[T]('\n')); err != nil {
 			return false
 		}
@@ -23,6 +19,25 @@ func LineComment[T comparable](start string) ConditionFunc[T] {
 	}
 }
 
+// BlockComment produces a ConditionFunc that can be used to ignore block comments, that is, comments that begin with the
+// character sequence in start and stretch until the next occurrence of the character sequence in end. A block comment
+// that is never terminated stretches until the end of the source.
+func BlockComment[T comparable](start string, end string) ConditionFunc[T] {
+	return func(l *Lexer[T], c uint8) bool {
+		if !strings.HasPrefix(l.source[l.cursor:], start) {
+			return false
+		}
+		closing := strings.Index(l.source[l.cursor+len(start):], end)
+		if closing == -1 {
+			l.cursor = len(l.source) - 1
+			return true
+		}
+		// Leave the cursor on the last byte of the comment since it is moved past the ignored byte by the caller.
+		l.cursor += len(start) + closing + len(end) - 1
+		return true
+	}
+}
+
 // Integer reads tokens that represent literal integers. The variant parameter defines what variant should be applied to
 // an integer token when one has been processed. Integer does not care about signs and thus the input "-10" would not be
 // considered an integer literal but rather some other token followed by an integer literal, in this case "10".
@@ -44,14 +59,16 @@ func StringLiteral[T comparable](variant T) Func[T] {
 		if c != '"' {
 			return Token[T]{}, false, nil
 		}
+		start := l.cursor
 		l.cursor++
 		literal := l.literal(func(lx *Lexer[T], c uint8) bool {
 			return c != '"'
 		})
-		l.cursor++
+		l.cursor = min(l.cursor+1, len(l.source))
 		token := Token[T]{
-			Variant: variant,
-			Literal: literal,
+			Variant:    variant,
+			Literal:    literal,
+			delimiters: l.cursor - start - len(literal),
 		}
 		return token, true, nil
 	}
@@ -1,14 +1,79 @@
 package lexer
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"unicode"
 )
 
 type Token[T comparable] struct {
-	Variant T
-	Literal string
+	Variant  T
+	Literal  string
+	Position Position
+	// delimiters counts the bytes of the source that belong to the token but not to its literal, such as the quotes of
+	// a string literal.
+	delimiters int
+}
+
+// End returns the Position immediately following the token in the source.
+func (t Token[T]) End() Position {
+	end := t.Position
+	end.Column += len(t.Literal) + t.delimiters
+	end.Offset += len(t.Literal) + t.delimiters
+	return end
+}
+
+// Position describes where in a source a token begins. Line and Column are 1-based while Offset is the 0-based byte
+// offset from the start of the source. File is empty unless the source was loaded through LoadFile.
+type Position struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Offset int    `json:"offset"`
+}
+
+// String formats the position as "file:line:col", omitting the file when it is unknown.
+func (p Position) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// Error is an error that is attributed to a Position in the source. End is optional and marks where the offending
+// section of the source ends, if known.
+type Error struct {
+	Position Position
+	End      Position
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Position, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errorf formats an error according to format and attributes it to pos. The format supports the same verbs as
+// fmt.Errorf, including %w.
+func Errorf(pos Position, format string, args ...any) error {
+	return &Error{
+		Position: pos,
+		Err:      fmt.Errorf(format, args...),
+	}
+}
+
+// TokenErrorf works like Errorf but attributes the error to the entire literal of tok.
+func TokenErrorf[T comparable](tok Token[T], format string, args ...any) error {
+	return &Error{
+		Position: tok.Position,
+		End:      tok.End(),
+		Err:      fmt.Errorf(format, args...),
+	}
 }
 
 type Func[T comparable] func(lexer *Lexer[T], c uint8) (Token[T], bool, error)
@@ -40,13 +105,52 @@ type Lexer[T comparable] struct {
 	delegates []Func[T]
 	source    string
 	cursor    int
+	file      string
+	// lines holds the offset at which each line of the source begins and is used to translate the cursor into a
+	// Position without having to track lines as the cursor moves back and forth.
+	lines []int
 }
 
 // Load configures the Lexer to read from the beginning of source when the next reading operation such as Next is
 // invoked.
 func (l *Lexer[T]) Load(source string) {
+	l.LoadFile("", source)
+}
+
+// LoadFile works like Load but also records the name of the file that source was read from, which is then included in
+// the Position of every token.
+func (l *Lexer[T]) LoadFile(file string, source string) {
 	l.source = source
 	l.cursor = 0
+	l.file = file
+	l.lines = []int{0}
+	for i := range source {
+		if source[i] == '\n' {
+			l.lines = append(l.lines, i+1)
+		}
+	}
+}
+
+// Position returns the Position of the internal cursor, which is where the next token will be read from unless it is
+// preceded by ignored bytes.
+func (l *Lexer[T]) Position() Position {
+	return l.position(l.cursor)
+}
+
+func (l *Lexer[T]) position(offset int) Position {
+	line := sort.Search(len(l.lines), func(i int) bool {
+		return l.lines[i] > offset
+	}) - 1
+	if line < 0 {
+		// The source was never loaded so the offset can only refer to the very beginning.
+		return Position{File: l.file, Line: 1, Column: offset + 1, Offset: offset}
+	}
+	return Position{
+		File:   l.file,
+		Line:   line + 1,
+		Column: offset - l.lines[line] + 1,
+		Offset: offset,
+	}
 }
 
 // More reports whether there are more tokens to read. Do keep in mind that the remaining token could be the simply EOF.
@@ -75,12 +179,14 @@ func (l *Lexer[T]) Next() (Token[T], error) {
 	if l.cursor >= len(l.source) {
 		return Token[T]{}, io.EOF
 	}
+	start := l.cursor
 	character := l.source[l.cursor]
 	if symbol, ok := l.symbols[character]; ok {
 		l.cursor++
 		return Token[T]{
-			Variant: symbol,
-			Literal: string(character),
+			Variant:  symbol,
+			Literal:  string(character),
+			Position: l.position(start),
 		}, nil
 	}
 	for _, delegate := range l.delegates {
@@ -89,19 +195,24 @@ func (l *Lexer[T]) Next() (Token[T], error) {
 			return Token[T]{}, err
 		}
 		if ok {
+			token.Position = l.position(start)
 			return token, nil
 		}
 	}
-	return Token[T]{}, fmt.Errorf("all delegates failed to process character '%s'", string(character))
+	return Token[T]{}, Errorf(l.position(start), "all delegates failed to process character '%s'", string(character))
 }
 
 func (l *Lexer[T]) Expect(v T) (Token[T], error) {
 	token, err := l.Next()
+	if errors.Is(err, io.EOF) {
+		// Running out of tokens while expecting one is an error in its own right rather than a natural end of input.
+		return Token[T]{}, Errorf(l.Position(), "%w", io.ErrUnexpectedEOF)
+	}
 	if err != nil {
 		return Token[T]{}, err
 	}
 	if token.Variant != v {
-		return Token[T]{}, fmt.Errorf("unexpected token variant: %v", token.Variant)
+		return Token[T]{}, TokenErrorf(token, "unexpected token variant: %v", token.Variant)
 	}
 	return token, nil
 }
@@ -124,6 +235,15 @@ func (l *Lexer[T]) Seek(c ConditionFunc[T]) error {
 	return nil
 }
 
+// Skip moves the internal cursor past any ignored bytes and the byte that follows them, which is where the next token
+// would begin. It allows recovering from a byte that the Lexer cannot make sense of.
+func (l *Lexer[T]) Skip() {
+	if err := l.Seek(Not(l.ignored)); err != nil {
+		return
+	}
+	l.cursor++
+}
+
 // Whitespace is a ConditionFunc that returns true when c is a whitespace character.
 func Whitespace[T comparable](lx *Lexer[T], c uint8) bool {
 	return unicode.IsSpace(rune(c))
@@ -1,5 +1,7 @@
 package simulator
 
+import "fmt"
+
 const (
 	DestinationMaskA = 0b100
 	DestinationMaskD = 0b010
@@ -14,91 +16,136 @@ const (
 	jmp = 0b111
 )
 
-var alu = map[uint8]func(*cpu) uint16{
-	0b0101010: func(c *cpu) uint16 {
-		return 0
-	},
-	0b0111111: func(c *cpu) uint16 {
-		return 1
-	},
-	0b0111010: func(c *cpu) uint16 {
-		return 0xFFFF
-	},
-	0b0001100: func(c *cpu) uint16 {
-		return c.d
-	},
-	0b0110000: func(c *cpu) uint16 {
-		return c.a
-	},
-	0b1110000: func(c *cpu) uint16 {
-		return c.m
-	},
-	0b0001101: func(c *cpu) uint16 {
-		return ^c.d
-	},
-	0b0110001: func(c *cpu) uint16 {
-		return ^c.a
-	},
-	0b1110001: func(c *cpu) uint16 {
-		return ^c.m
-	},
-	0b0001111: func(c *cpu) uint16 {
-		return uint16(int(c.d) * -1)
-	},
-	0b0110011: func(c *cpu) uint16 {
-		return uint16(int(c.a) * -1)
-	},
-	0b1110011: func(c *cpu) uint16 {
-		return uint16(int(c.m) * -1)
-	},
-	0b0011111: func(c *cpu) uint16 {
-		return c.d + 1
-	},
-	0b0110111: func(c *cpu) uint16 {
-		return c.a + 1
-	},
-	0b1110111: func(c *cpu) uint16 {
-		return c.m + 1
-	},
-	0b0001110: func(c *cpu) uint16 {
-		return c.d - 1
-	},
-	0b0110010: func(c *cpu) uint16 {
-		return c.a - 1
-	},
-	0b1110010: func(c *cpu) uint16 {
-		return c.m - 1
-	},
-	0b0000010: func(c *cpu) uint16 {
-		return c.d + c.a
-	},
-	0b1000010: func(c *cpu) uint16 {
-		return c.d + c.m
-	},
-	0b0010011: func(c *cpu) uint16 {
-		return c.d - c.a
-	},
-	0b1010011: func(c *cpu) uint16 {
-		return c.d - c.m
-	},
-	0b0000111: func(c *cpu) uint16 {
-		return c.a - c.d
-	},
-	0b1000111: func(c *cpu) uint16 {
-		return c.m - c.d
-	},
-	0b0000000: func(c *cpu) uint16 {
-		return c.d & c.a
-	},
-	0b1000000: func(c *cpu) uint16 {
-		return c.d & c.m
-	},
-	0b0010101: func(c *cpu) uint16 {
-		return c.d | c.a
-	},
-	0b1010101: func(c *cpu) uint16 {
-		return c.d | c.m
-	},
+// operation is a computation of the ALU or a shift of the extended instruction set. The zero operation is illegal.
+type operation uint8
+
+const (
+	illegal operation = iota
+	zero
+	one
+	minusOne
+	valueD
+	valueA
+	valueM
+	notD
+	notA
+	notM
+	negD
+	negA
+	negM
+	incD
+	incA
+	incM
+	decD
+	decA
+	decM
+	dPlusA
+	dPlusM
+	dMinusA
+	dMinusM
+	aMinusD
+	mMinusD
+	dAndA
+	dAndM
+	dOrA
+	dOrM
+	shlA
+	shlD
+	shlM
+	shrA
+	shrD
+	shrM
+)
+
+// alu maps the comp bits of compute instructions, including the a-bit, to the operation they select.
+var alu = [128]operation{
+	0b0101010: zero,
+	0b0111111: one,
+	0b0111010: minusOne,
+	0b0001100: valueD,
+	0b0110000: valueA,
+	0b1110000: valueM,
+	0b0001101: notD,
+	0b0110001: notA,
+	0b1110001: notM,
+	0b0001111: negD,
+	0b0110011: negA,
+	0b1110011: negM,
+	0b0011111: incD,
+	0b0110111: incA,
+	0b1110111: incM,
+	0b0001110: decD,
+	0b0110010: decA,
+	0b1110010: decM,
+	0b0000010: dPlusA,
+	0b1000010: dPlusM,
+	0b0010011: dMinusA,
+	0b1010011: dMinusM,
+	0b0000111: aMinusD,
+	0b1000111: mMinusD,
+	0b0000000: dAndA,
+	0b1000000: dAndM,
+	0b0010101: dOrA,
+	0b1010101: dOrM,
+}
+
+// shifter maps the comp bits of compute instructions that have bit 14 cleared to the shifts of the extended instruction
+// set.
+var shifter = [128]operation{
+	0b0100000: shlA,
+	0b0110000: shlD,
+	0b1100000: shlM,
+	0b0000000: shrA,
+	0b0010000: shrD,
+	0b1000000: shrM,
+}
+
+// instruction is an instruction decoded ahead of its execution, such that the fields of compute instructions need not
+// be extracted from the instruction word on every cycle.
+type instruction struct {
+	load bool
+	op   operation
+	dest uint8
+	jump uint8
+	// value is the value loaded into A by an A-instruction.
+	value uint16
+}
+
+// decode decodes an instruction word. Compute instructions with an undefined computation decode to the illegal
+// operation.
+func decode(word uint16, extended bool) instruction {
+	if low(word, 15) {
+		// The instruction is an A-instruction if the MSB is low.
+		return instruction{load: true, value: word}
+	}
+	table := &alu
+	if extended && low(word, 14) {
+		table = &shifter
+	}
+	return instruction{
+		op:   table[(word>>6)&0b1111111],
+		dest: uint8(word>>3) & 0b111,
+		jump: uint8(word) & 0b111,
+	}
+}
+
+func (i instruction) legal() bool {
+	return i.load || i.op != illegal
+}
+
+// writes reports whether the instruction writes to RAM.
+func (i instruction) writes() bool {
+	return !i.load && i.dest&DestinationMaskM != 0
+}
+
+// IllegalInstructionError is returned when the simulator meets an instruction that does not encode a computation.
+type IllegalInstructionError struct {
+	PC          uint16
+	Instruction uint16
+}
+
+func (e *IllegalInstructionError) Error() string {
+	return fmt.Sprintf("illegal instruction %016b at PC %d", e.Instruction, e.PC)
 }
 
 type cpu struct {
@@ -106,38 +153,43 @@ type cpu struct {
 	d  uint16
 	m  uint16
 	pc uint16
+	// extended enables the shift instructions of the extended instruction set.
+	extended bool
 }
 
+// addressMask selects the 15 bits of A that are wired to the address inputs of the RAM and ROM. The most significant
+// bit of A is ignored when addressing memory, just as it is by the Hack computer.
+const addressMask = 0x7FFF
+
 func (c *cpu) address() uint16 {
-	return c.a
+	return c.a & addressMask
 }
 
+// execute decodes and runs a single instruction word.
 func (c *cpu) execute(in uint16) bool {
-	if low(in, 15) {
-		// The instruction is an A-instruction if the MSB is low.
-		c.a = in
-		c.pc++
-		return false
-	}
-	return c.compute(in)
+	return c.run(decode(in, c.extended))
 }
 
-func (c *cpu) compute(instruction uint16) (w bool) {
-	code := uint8((instruction >> 6) & 0b1111111)
-	computed := alu[code](c)
-	destination := (instruction >> 3) & 0b111
-	if mask(destination, DestinationMaskA) {
+// run executes a decoded instruction and reports whether it writes M to memory.
+func (c *cpu) run(ins instruction) (w bool) {
+	if ins.load {
+		c.a = ins.value
+		c.pc = (c.pc + 1) & addressMask
+		return false
+	}
+	computed := c.compute(ins.op)
+	if ins.dest&DestinationMaskA != 0 {
 		c.a = computed
 	}
-	if mask(destination, DestinationMaskD) {
+	if ins.dest&DestinationMaskD != 0 {
 		c.d = computed
 	}
-	if mask(destination, DestinationMaskM) {
+	if ins.dest&DestinationMaskM != 0 {
 		c.m = computed
 		w = true
 	}
 	jump := false
-	switch instruction & 0b111 {
+	switch ins.jump {
 	case jgt:
 		jump = computed != 0 && low(computed, 15)
 	case jeq:
@@ -156,7 +208,82 @@ func (c *cpu) compute(instruction uint16) (w bool) {
 	if jump {
 		c.pc = c.address()
 	} else {
-		c.pc++
+		c.pc = (c.pc + 1) & addressMask
 	}
 	return
 }
+
+// compute returns the result of op, which is zero for the illegal operation.
+func (c *cpu) compute(op operation) uint16 {
+	switch op {
+	case zero:
+		return 0
+	case one:
+		return 1
+	case minusOne:
+		return 0xFFFF
+	case valueD:
+		return c.d
+	case valueA:
+		return c.a
+	case valueM:
+		return c.m
+	case notD:
+		return ^c.d
+	case notA:
+		return ^c.a
+	case notM:
+		return ^c.m
+	case negD:
+		return -c.d
+	case negA:
+		return -c.a
+	case negM:
+		return -c.m
+	case incD:
+		return c.d + 1
+	case incA:
+		return c.a + 1
+	case incM:
+		return c.m + 1
+	case decD:
+		return c.d - 1
+	case decA:
+		return c.a - 1
+	case decM:
+		return c.m - 1
+	case dPlusA:
+		return c.d + c.a
+	case dPlusM:
+		return c.d + c.m
+	case dMinusA:
+		return c.d - c.a
+	case dMinusM:
+		return c.d - c.m
+	case aMinusD:
+		return c.a - c.d
+	case mMinusD:
+		return c.m - c.d
+	case dAndA:
+		return c.d & c.a
+	case dAndM:
+		return c.d & c.m
+	case dOrA:
+		return c.d | c.a
+	case dOrM:
+		return c.d | c.m
+	case shlA:
+		return c.a << 1
+	case shlD:
+		return c.d << 1
+	case shlM:
+		return c.m << 1
+	case shrA:
+		return uint16(int16(c.a) >> 1)
+	case shrD:
+		return uint16(int16(c.d) >> 1)
+	case shrM:
+		return uint16(int16(c.m) >> 1)
+	}
+	return 0
+}
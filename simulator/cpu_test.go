@@ -1,6 +1,7 @@
 package simulator
 
 import (
+	"fmt"
 	"testing"
 )
 
@@ -611,3 +612,179 @@ func TestCPU_compute(t *testing.T) {
 		})
 	}
 }
+
+func TestCPU_computeExtended(t *testing.T) {
+	tests := []struct {
+		name        string
+		instruction uint16
+		expected    uint16
+	}{
+		{name: "D=A<<", instruction: 0b101_0100000_010_000, expected: 0b0000_0000_0000_1100},
+		{name: "D=D<<", instruction: 0b101_0110000_010_000, expected: 0b1000_0000_0000_0010},
+		{name: "D=M<<", instruction: 0b101_1100000_010_000, expected: 0b0000_0000_1111_1110},
+		{name: "D=A>>", instruction: 0b101_0000000_010_000, expected: 0b0000_0000_0000_0011},
+		{name: "D=D>>", instruction: 0b101_0010000_010_000, expected: 0b1110_0000_0000_0000},
+		{name: "D=M>>", instruction: 0b101_1000000_010_000, expected: 0b0000_0000_0011_1111},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := cpu{
+				a:        0b0000_0000_0000_0110,
+				d:        0b1100_0000_0000_0001,
+				m:        0b0000_0000_0111_1111,
+				extended: true,
+			}
+			c.execute(test.instruction)
+			if c.d != test.expected {
+				t.Errorf("expected d to equal %016b but got %016b", test.expected, c.d)
+			}
+			if c.pc != 1 {
+				t.Errorf("expected pc to equal 1 but got %v", c.pc)
+			}
+		})
+	}
+	t.Run("standard", func(t *testing.T) {
+		// Without the extended instruction set bit 14 is ignored, as it is by the Hack CPU.
+		c := cpu{a: 6, d: 1}
+		c.execute(0b101_0110000_010_000)
+		if c.d != 6 {
+			t.Errorf("expected d to equal 6 but got %v", c.d)
+		}
+	})
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		word     uint16
+		extended bool
+		legal    bool
+	}{
+		{word: 0b111_0101010_000_111, legal: true},
+		{word: 0b111_1111111_010_000, legal: false},
+		{word: 0b101_0110000_010_000, legal: true},
+		{word: 0b101_0110000_010_000, extended: true, legal: true},
+		{word: 0b101_0101010_010_000, extended: true, legal: false},
+		{word: 0b011_1111111_111_111, extended: true, legal: true},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%016b", test.word), func(t *testing.T) {
+			if legal := decode(test.word, test.extended).legal(); legal != test.legal {
+				t.Errorf("expected legal to be %v but got %v", test.legal, legal)
+			}
+		})
+	}
+}
+
+// closures is the ALU as the simulator implemented it before instructions were decoded ahead of time, kept to measure
+// the old execution path against the decoded one.
+var closures = map[uint8]func(*cpu) uint16{
+	0b0101010: func(c *cpu) uint16 { return 0 },
+	0b0111111: func(c *cpu) uint16 { return 1 },
+	0b0111010: func(c *cpu) uint16 { return 0xFFFF },
+	0b0001100: func(c *cpu) uint16 { return c.d },
+	0b0110000: func(c *cpu) uint16 { return c.a },
+	0b1110000: func(c *cpu) uint16 { return c.m },
+	0b0001101: func(c *cpu) uint16 { return ^c.d },
+	0b0110001: func(c *cpu) uint16 { return ^c.a },
+	0b1110001: func(c *cpu) uint16 { return ^c.m },
+	0b0001111: func(c *cpu) uint16 { return uint16(int(c.d) * -1) },
+	0b0110011: func(c *cpu) uint16 { return uint16(int(c.a) * -1) },
+	0b1110011: func(c *cpu) uint16 { return uint16(int(c.m) * -1) },
+	0b0011111: func(c *cpu) uint16 { return c.d + 1 },
+	0b0110111: func(c *cpu) uint16 { return c.a + 1 },
+	0b1110111: func(c *cpu) uint16 { return c.m + 1 },
+	0b0001110: func(c *cpu) uint16 { return c.d - 1 },
+	0b0110010: func(c *cpu) uint16 { return c.a - 1 },
+	0b1110010: func(c *cpu) uint16 { return c.m - 1 },
+	0b0000010: func(c *cpu) uint16 { return c.d + c.a },
+	0b1000010: func(c *cpu) uint16 { return c.d + c.m },
+	0b0010011: func(c *cpu) uint16 { return c.d - c.a },
+	0b1010011: func(c *cpu) uint16 { return c.d - c.m },
+	0b0000111: func(c *cpu) uint16 { return c.a - c.d },
+	0b1000111: func(c *cpu) uint16 { return c.m - c.d },
+	0b0000000: func(c *cpu) uint16 { return c.d & c.a },
+	0b1000000: func(c *cpu) uint16 { return c.d & c.m },
+	0b0010101: func(c *cpu) uint16 { return c.d | c.a },
+	0b1010101: func(c *cpu) uint16 { return c.d | c.m },
+}
+
+// interpret executes an instruction word the way the simulator did before instructions were decoded ahead of time,
+// looking up the computation in closures on every cycle.
+func (c *cpu) interpret(in uint16) (w bool) {
+	if low(in, 15) {
+		c.a = in
+		c.pc = (c.pc + 1) & addressMask
+		return false
+	}
+	computed := closures[uint8((in>>6)&0b1111111)](c)
+	destination := (in >> 3) & 0b111
+	if mask(destination, DestinationMaskA) {
+		c.a = computed
+	}
+	if mask(destination, DestinationMaskD) {
+		c.d = computed
+	}
+	if mask(destination, DestinationMaskM) {
+		c.m = computed
+		w = true
+	}
+	jump := false
+	switch in & 0b111 {
+	case jgt:
+		jump = computed != 0 && low(computed, 15)
+	case jeq:
+		jump = computed == 0
+	case jge:
+		jump = low(computed, 15)
+	case jlt:
+		jump = high(computed, 15)
+	case jne:
+		jump = computed != 0
+	case jle:
+		jump = computed == 0 || high(computed, 15)
+	case jmp:
+		jump = true
+	}
+	if jump {
+		c.pc = c.address()
+	} else {
+		c.pc = (c.pc + 1) & addressMask
+	}
+	return
+}
+
+// BenchmarkCPU compares the old execution path, which looks up a closure for every instruction as it executes, with
+// decoding every instruction as it executes and with executing instructions decoded ahead of time.
+func BenchmarkCPU(b *testing.B) {
+	rom := load(b, multiply)
+	decoded := make([]instruction, len(rom))
+	for i, word := range rom {
+		decoded[i] = decode(word, false)
+	}
+	execute := map[string]func(c *cpu) bool{
+		"closures": func(c *cpu) bool {
+			return c.interpret(rom[c.pc])
+		},
+		"decoding": func(c *cpu) bool {
+			return c.run(decode(rom[c.pc], false))
+		},
+		"decoded": func(c *cpu) bool {
+			return c.run(decoded[c.pc])
+		},
+	}
+	for _, name := range []string{"closures", "decoding", "decoded"} {
+		b.Run(name, func(b *testing.B) {
+			var ram [32768]uint16
+			c := cpu{}
+			next := execute[name]
+			for range b.N {
+				address := c.address()
+				c.m = ram[address]
+				if next(&c) {
+					ram[address] = c.m
+				}
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "instructions/s")
+		})
+	}
+}
@@ -0,0 +1,445 @@
+package simulator
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/crookdc/nand2tetris/asm"
+	"github.com/crookdc/nand2tetris/lexer"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// refreshInterval is the number of instructions executed between refreshes of the screen and keyboard while the
+// debugger runs the program.
+const refreshInterval = 100_000
+
+type DebuggerParameters struct {
+	Simulator *Simulator
+	// Labels maps labels to ROM addresses and Variables maps variables to RAM addresses. Both are optional and allow
+	// locations to be referenced by name.
+	Labels    map[string]int
+	Variables map[string]int
+	// Lines optionally holds the source position of the instruction at every ROM address.
+	Lines []lexer.Position
+	// Origins optionally holds what the instruction at every ROM address was generated from, such as a VM command.
+	Origins []asm.Origin
+	Input   io.Reader
+	Output  io.Writer
+}
+
+func NewDebugger(params DebuggerParameters) *Debugger {
+	d := Debugger{
+		sim:         params.Simulator,
+		labels:      make(map[string]uint16),
+		variables:   make(map[string]uint16),
+		breakpoints: make(map[uint16]bool),
+		watchpoints: make(map[uint16]uint16),
+		lines:       params.Lines,
+		origins:     params.Origins,
+		in:          bufio.NewScanner(params.Input),
+		out:         params.Output,
+	}
+	for name, addr := range params.Labels {
+		d.labels[name] = uint16(addr)
+	}
+	for name, addr := range params.Variables {
+		d.variables[name] = uint16(addr)
+	}
+	for name, addr := range predefined {
+		if _, ok := d.variables[name]; !ok {
+			d.variables[name] = addr
+		}
+	}
+	return &d
+}
+
+var predefined = map[string]uint16{
+	"SP":     0,
+	"LCL":    1,
+	"ARG":    2,
+	"THIS":   3,
+	"THAT":   4,
+	"SCREEN": ScreenMemoryMapBegin,
+	"KBD":    uint16(KeyboardMemoryMapAddress),
+}
+
+// Debugger drives a Simulator from an interactive command line. Execution can be stopped on breakpoints, which are ROM
+// addresses, and on watchpoints, which are RAM addresses whose value changes.
+type Debugger struct {
+	sim         *Simulator
+	labels      map[string]uint16
+	variables   map[string]uint16
+	breakpoints map[uint16]bool
+	watchpoints map[uint16]uint16
+	lines       []lexer.Position
+	origins     []asm.Origin
+	in          *bufio.Scanner
+	out         io.Writer
+}
+
+// Run reads and executes commands until the input ends or the quit command is given.
+func (d *Debugger) Run() error {
+	d.printf("type help for a list of commands\n")
+	d.location()
+	for {
+		d.printf("(hack) ")
+		if !d.in.Scan() {
+			return d.in.Err()
+		}
+		quit, err := d.Execute(d.in.Text())
+		if err != nil {
+			d.printf("error: %v\n", err)
+		}
+		if quit {
+			return nil
+		}
+		if err := d.sim.Refresh(); err != nil {
+			return err
+		}
+	}
+}
+
+const help = `break|b <location>     stop before executing the instruction at a ROM address or label, such as LOOP+3
+delete|d <location>    remove a breakpoint
+watch|w <address>      stop when the value at a RAM address or variable changes
+unwatch <address>      remove a watchpoint
+step|s [n]             execute one or n instructions
+next|n                 like step but executes a VM function call in full
+reverse-step|rs [n]    undo the last one or n instructions
+rewind|rw <address>    run backwards until just before the value at a RAM address or variable was last written
+continue|c             run until a breakpoint or watchpoint is hit or the program halts
+registers|r            show A, D and PC
+x <address> [n]        show one or n words of RAM starting at address
+info|i                 list breakpoints and watchpoints
+quit|q                 exit the debugger
+`
+
+// Execute runs a single debugger command and reports whether the debugger should quit.
+func (d *Debugger) Execute(line string) (bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false, nil
+	}
+	args := fields[1:]
+	switch fields[0] {
+	case "help", "h":
+		d.printf("%s", help)
+	case "quit", "q":
+		return true, nil
+	case "break", "b":
+		if len(args) != 1 {
+			return false, errors.New("usage: break <location>")
+		}
+		addr, err := d.rom(args[0])
+		if err != nil {
+			return false, err
+		}
+		d.breakpoints[addr] = true
+		d.printf("breakpoint at %s\n", d.describe(addr))
+	case "delete", "d":
+		if len(args) != 1 {
+			return false, errors.New("usage: delete <location>")
+		}
+		addr, err := d.rom(args[0])
+		if err != nil {
+			return false, err
+		}
+		delete(d.breakpoints, addr)
+	case "watch", "w":
+		if len(args) != 1 {
+			return false, errors.New("usage: watch <address>")
+		}
+		addr, err := d.ram(args[0])
+		if err != nil {
+			return false, err
+		}
+		d.watchpoints[addr] = d.sim.Peek(addr)
+		d.printf("watchpoint on RAM[%d] = %d\n", addr, int16(d.sim.Peek(addr)))
+	case "unwatch":
+		if len(args) != 1 {
+			return false, errors.New("usage: unwatch <address>")
+		}
+		addr, err := d.ram(args[0])
+		if err != nil {
+			return false, err
+		}
+		delete(d.watchpoints, addr)
+	case "step", "s":
+		n := 1
+		if len(args) > 0 {
+			var err error
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+				return false, fmt.Errorf("invalid step count %s", args[0])
+			}
+		}
+		for range n {
+			if d.sim.Halted() {
+				break
+			}
+			if err := d.sim.Step(); err != nil {
+				d.location()
+				return false, err
+			}
+			d.watched()
+		}
+		d.location()
+	case "reverse-step", "rs":
+		n := 1
+		if len(args) > 0 {
+			var err error
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+				return false, fmt.Errorf("invalid step count %s", args[0])
+			}
+		}
+		defer d.rewatch()
+		for range n {
+			if err := d.sim.StepBack(); err != nil {
+				d.location()
+				return false, err
+			}
+		}
+		d.location()
+	case "rewind", "rw":
+		if len(args) != 1 {
+			return false, errors.New("usage: rewind <address>")
+		}
+		addr, err := d.ram(args[0])
+		if err != nil {
+			return false, err
+		}
+		defer d.rewatch()
+		n, err := d.sim.RewindUntilWritten(addr)
+		if err != nil && n == 0 {
+			return false, err
+		}
+		if err != nil {
+			d.location()
+			return false, fmt.Errorf(
+				"RAM[%d] was not written within the last %d instructions, stepped back to the oldest instruction kept",
+				addr, n,
+			)
+		}
+		d.printf("stepped back %d instructions to the last write of RAM[%d]\n", n, addr)
+		d.location()
+	case "next", "n":
+		if err := d.next(); err != nil {
+			return false, err
+		}
+	case "continue", "c":
+		d.run(func() bool { return false })
+	case "registers", "r":
+		d.location()
+	case "x":
+		if len(args) < 1 || len(args) > 2 {
+			return false, errors.New("usage: x <address> [n]")
+		}
+		addr, err := d.ram(args[0])
+		if err != nil {
+			return false, err
+		}
+		n := 1
+		if len(args) == 2 {
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				return false, fmt.Errorf("invalid word count %s", args[1])
+			}
+		}
+		for i := range n {
+			a := addr + uint16(i)
+			d.printf("RAM[%d] = %d\n", a, int16(d.sim.Peek(a)))
+		}
+	case "info", "i":
+		for _, addr := range sorted(d.breakpoints) {
+			d.printf("breakpoint at %s\n", d.describe(addr))
+		}
+		for _, addr := range sorted(d.watchpoints) {
+			d.printf("watchpoint on RAM[%d] = %d\n", addr, int16(d.watchpoints[addr]))
+		}
+	default:
+		return false, fmt.Errorf("unknown command %s, type help for a list of commands", fields[0])
+	}
+	return false, nil
+}
+
+// next steps over calls generated by the VM translator, which end in an unconditional jump directly followed by the
+// return address label. Any other instruction is executed like step does.
+func (d *Debugger) next() error {
+	pc := d.sim.PC()
+	ins := d.sim.ROM(pc)
+	ret := pc + 1
+	if low(ins, 15) || ins&0b111 != jmp || !d.returnAddress(ret) {
+		err := d.sim.Step()
+		d.watched()
+		d.location()
+		return err
+	}
+	// Recursive calls return to the same address with a deeper stack, the outer call has returned once the stack is
+	// back to at most its height at the call.
+	sp := d.sim.Peek(0)
+	if err := d.sim.Step(); err != nil {
+		d.location()
+		return err
+	}
+	if d.watched() {
+		d.location()
+		return nil
+	}
+	d.run(func() bool {
+		return d.sim.PC() == ret && d.sim.Peek(0) <= sp+1
+	})
+	return nil
+}
+
+func (d *Debugger) returnAddress(addr uint16) bool {
+	for name, a := range d.labels {
+		if a == addr && strings.Contains(name, "$ret.") {
+			return true
+		}
+	}
+	return false
+}
+
+// run executes instructions until done returns true, a breakpoint or watchpoint is hit or the program halts.
+func (d *Debugger) run(done func() bool) {
+	for i := 1; ; i++ {
+		if d.sim.Halted() {
+			if err := d.sim.Err(); err != nil {
+				d.printf("error: %v\n", err)
+			} else {
+				d.printf("program has halted\n")
+			}
+			break
+		}
+		if err := d.sim.Step(); err != nil {
+			d.printf("error: %v\n", err)
+			break
+		}
+		if done() {
+			break
+		}
+		if d.breakpoints[d.sim.PC()] {
+			d.printf("breakpoint hit\n")
+			break
+		}
+		if d.watched() {
+			break
+		}
+		if i%refreshInterval == 0 {
+			if err := d.sim.Refresh(); err != nil {
+				d.printf("error: %v\n", err)
+				break
+			}
+		}
+	}
+	d.location()
+}
+
+// watched reports whether any watched RAM address has changed, reporting the changes. The changed values are stored
+// such that every change is reported once.
+func (d *Debugger) watched() bool {
+	changed := false
+	for addr, old := range d.watchpoints {
+		if v := d.sim.Peek(addr); v != old {
+			d.printf("watchpoint RAM[%d] changed from %d to %d\n", addr, int16(old), int16(v))
+			d.watchpoints[addr] = v
+			changed = true
+		}
+	}
+	return changed
+}
+
+// rewatch updates the values of the watchpoints after stepping back, such that undone writes are not reported as
+// changes.
+func (d *Debugger) rewatch() {
+	for addr := range d.watchpoints {
+		d.watchpoints[addr] = d.sim.Peek(addr)
+	}
+}
+
+func (d *Debugger) location() {
+	d.printf("A=%d D=%d PC=%s\n", int16(d.sim.A()), int16(d.sim.D()), d.describe(d.sim.PC()))
+	if pc := int(d.sim.PC()); pc < len(d.origins) {
+		d.printf("in %s\n", d.origins[pc])
+	}
+}
+
+// describe formats a ROM address along with its position relative to the closest preceding label and the line in the
+// source that it was assembled from, if known.
+func (d *Debugger) describe(addr uint16) string {
+	str := d.relative(addr)
+	if int(addr) >= len(d.lines) {
+		return str
+	}
+	pos := d.lines[addr]
+	if pos.File == "" {
+		return fmt.Sprintf("%s at line %d", str, pos.Line)
+	}
+	return fmt.Sprintf("%s at %s:%d", str, pos.File, pos.Line)
+}
+
+func (d *Debugger) relative(addr uint16) string {
+	closest, name := -1, ""
+	for l, a := range d.labels {
+		if a <= addr && (int(a) > closest || (int(a) == closest && l < name)) {
+			closest, name = int(a), l
+		}
+	}
+	if closest < 0 {
+		return strconv.Itoa(int(addr))
+	}
+	if int(addr) == closest {
+		return fmt.Sprintf("%d (%s)", addr, name)
+	}
+	return fmt.Sprintf("%d (%s+%d)", addr, name, int(addr)-closest)
+}
+
+// rom resolves a ROM location given as an address, a label or a label with an offset such as LOOP+3.
+func (d *Debugger) rom(location string) (uint16, error) {
+	if addr, err := strconv.ParseUint(location, 10, 15); err == nil {
+		return uint16(addr), nil
+	}
+	name, offset, found := strings.Cut(location, "+")
+	addr, ok := d.labels[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown label %s", name)
+	}
+	if !found {
+		return addr, nil
+	}
+	n, err := strconv.ParseUint(offset, 10, 15)
+	if err != nil {
+		return 0, fmt.Errorf("invalid offset %s", offset)
+	}
+	return addr + uint16(n), nil
+}
+
+// ram resolves a RAM address given as an address, a variable or a predefined symbol.
+func (d *Debugger) ram(location string) (uint16, error) {
+	if addr, err := strconv.ParseUint(location, 10, 15); err == nil {
+		return uint16(addr), nil
+	}
+	if addr, ok := d.variables[location]; ok {
+		return addr, nil
+	}
+	if strings.HasPrefix(location, "R") {
+		if n, err := strconv.ParseUint(location[1:], 10, 4); err == nil {
+			return uint16(n), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown variable %s", location)
+}
+
+func (d *Debugger) printf(format string, args ...any) {
+	_, _ = fmt.Fprintf(d.out, format, args...)
+}
+
+func sorted[V any](m map[uint16]V) []uint16 {
+	keys := make([]uint16, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,177 @@
+package simulator
+
+import (
+	"bytes"
+	"github.com/crookdc/nand2tetris/asm"
+	"github.com/crookdc/nand2tetris/lexer"
+	"strings"
+	"testing"
+)
+
+const debuggee = `@5
+D=A
+@x
+M=D
+(LOOP)
+@x
+M=M-1
+D=M
+@LOOP
+D;JGT
+@Main.f
+0;JMP
+(Main.main$ret.1)
+@y
+M=1
+(END)
+@END
+0;JMP
+(Main.f)
+@y
+M=-1
+@Main.main$ret.1
+0;JMP
+`
+
+func debug(t *testing.T, commands ...string) string {
+	_, debug, err := asm.AssembleDebug("Main.asm", debuggee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	d := NewDebugger(DebuggerParameters{
+		Simulator: New(Parameters{ROM: load(t, debuggee), History: 1000}),
+		Labels:    debug.Labels,
+		Variables: debug.Variables,
+		Lines:     debug.Lines,
+		Input:     strings.NewReader(strings.Join(commands, "\n")),
+		Output:    &out,
+	})
+	if err := d.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestDebugger(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands []string
+		expected []string
+	}{
+		{
+			name:     "breakpoint",
+			commands: []string{"break LOOP+2", "continue", "x x", "continue", "x x", "registers"},
+			expected: []string{
+				"breakpoint at 6 (LOOP+2) at Main.asm:8",
+				"breakpoint hit\nA=16 D=5 PC=6 (LOOP+2)",
+				"RAM[16] = 4",
+				"RAM[16] = 3",
+				"A=16 D=4 PC=6 (LOOP+2)",
+			},
+		},
+		{
+			name:     "watchpoint",
+			commands: []string{"watch y", "continue", "unwatch y", "continue"},
+			expected: []string{
+				"watchpoint on RAM[17] = 0",
+				"watchpoint RAM[17] changed from 0 to -1\nA=17 D=0 PC=17 (Main.f+2)",
+				"program has halted\nA=13 D=0 PC=14 (END+1)",
+			},
+		},
+		{
+			name:     "watchpoint while stepping",
+			commands: []string{"watch x", "step 4", "continue", "info"},
+			expected: []string{
+				"watchpoint RAM[16] changed from 0 to 5\nA=16 D=5 PC=4 (LOOP)",
+				"watchpoint RAM[16] changed from 5 to 4\nA=16 D=5 PC=6 (LOOP+2)",
+				"watchpoint on RAM[16] = 4",
+			},
+		},
+		{
+			name:     "step over call",
+			commands: []string{"b 10", "c", "next", "x y", "step 2", "x y", "n", "info"},
+			expected: []string{
+				"A=11 D=0 PC=11 (Main.main$ret.1)",
+				"RAM[17] = -1",
+				"A=17 D=0 PC=13 (END)",
+				"RAM[17] = 1",
+				"PC=14 (END+1)",
+				"breakpoint at 10 (LOOP+6)",
+			},
+		},
+		{
+			name:     "reverse",
+			commands: []string{"watch y", "continue", "rewind y", "x y", "rs 2", "continue", "rewind x", "rw 100", "rw y"},
+			expected: []string{
+				"stepped back 1 instructions to the last write of RAM[17]\nA=17 D=0 PC=16 (Main.f+1)",
+				"RAM[17] = 0",
+				"A=15 D=0 PC=10 (LOOP+6)",
+				"watchpoint RAM[17] changed from 0 to -1\nA=17 D=0 PC=17 (Main.f+2)",
+				"stepped back 8 instructions to the last write of RAM[16]\nA=16 D=1 PC=5 (LOOP+1)",
+				"A=0 D=0 PC=0 at Main.asm:1\nerror: RAM[100] was not written within the last 25 instructions, " +
+					"stepped back to the oldest instruction kept",
+				"(hack) error: no more history",
+			},
+		},
+		{
+			name:     "errors",
+			commands: []string{"break NOWHERE", "x", "frobnicate", "step -1"},
+			expected: []string{
+				"error: unknown label NOWHERE",
+				"error: usage: x <address> [n]",
+				"error: unknown command frobnicate",
+				"error: invalid step count -1",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := debug(t, test.commands...)
+			for _, expected := range test.expected {
+				if !strings.Contains(out, expected) {
+					t.Errorf("expected output to contain %q\n%s", expected, out)
+				}
+			}
+		})
+	}
+}
+
+func TestDebugger_origins(t *testing.T) {
+	push := asm.Origin{Position: lexer.Position{File: "Main.vm", Line: 2}, Function: "Main.main", Command: "push constant 7"}
+	halt := asm.Origin{Position: lexer.Position{File: "Main.vm", Line: 4}, Function: "Main.main", Command: "goto END"}
+	program, debug, err := asm.AssembleGenerated(
+		"",
+		[]string{"@7", "D=A", "(Main.main$END)", "@Main.main$END", "0;JMP"},
+		[]asm.Origin{push, push, halt, halt, halt},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rom := make([]uint16, len(program))
+	for i, ins := range program {
+		for _, bit := range ins {
+			rom[i] = rom[i]<<1 | uint16(bit)
+		}
+	}
+	var out bytes.Buffer
+	d := NewDebugger(DebuggerParameters{
+		Simulator: New(Parameters{ROM: rom}),
+		Labels:    debug.Labels,
+		Origins:   debug.Origins,
+		Input:     strings.NewReader("step\nstep\n"),
+		Output:    &out,
+	})
+	if err := d.Run(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"PC=1\nin Main.main: push constant 7 (Main.vm:2)",
+		"PC=2 (Main.main$END)\nin Main.main: goto END (Main.vm:4)",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out.String(), e) {
+			t.Errorf("expected output to contain %q\n%s", e, out.String())
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package simulator
+
+// NullScreen discards everything drawn on it.
+type NullScreen struct{}
+
+func (NullScreen) Clear() error {
+	return nil
+}
+
+func (NullScreen) Fill(Color, ...Point) error {
+	return nil
+}
+
+func (NullScreen) Present() {}
+
+// NullKeyboard never has a key pressed.
+type NullKeyboard struct{}
+
+func (NullKeyboard) Poll() uint16 {
+	return 0
+}
+
+// MemoryScreen keeps the most recently presented frame in memory so that it can be inspected.
+type MemoryScreen struct {
+	pending [256][512]Color
+	frame   [256][512]Color
+	// Frames is the number of frames presented so far.
+	Frames int
+}
+
+func (m *MemoryScreen) Clear() error {
+	m.pending = [256][512]Color{}
+	return nil
+}
+
+func (m *MemoryScreen) Fill(color Color, points ...Point) error {
+	for _, p := range points {
+		if int(p.Y) < len(m.pending) && int(p.X) < len(m.pending[p.Y]) {
+			m.pending[p.Y][p.X] = color
+		}
+	}
+	return nil
+}
+
+func (m *MemoryScreen) Present() {
+	m.frame = m.pending
+	m.Frames++
+}
+
+// Pixel returns the color of the pixel at (x, y) in the most recently presented frame.
+func (m *MemoryScreen) Pixel(x, y uint16) Color {
+	return m.frame[y%256][x%512]
+}
+
+// MemoryKeyboard reports Key as the currently pressed key, zero meaning that no key is pressed.
+type MemoryKeyboard struct {
+	Key uint16
+}
+
+func (m *MemoryKeyboard) Poll() uint16 {
+	return m.Key
+}
@@ -0,0 +1,99 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoHistory is returned when stepping back past the oldest instruction kept in the history.
+var ErrNoHistory = errors.New("no more history")
+
+// errHistoryDisabled is returned when stepping back without a history being kept at all.
+var errHistoryDisabled = fmt.Errorf("%w, the history is disabled", ErrNoHistory)
+
+// delta holds what an instruction changed, such that it can be undone: the registers before it executed and, if it
+// wrote to RAM, the value it overwrote.
+type delta struct {
+	a       uint16
+	d       uint16
+	pc      uint16
+	write   bool
+	address uint16
+	old     uint16
+}
+
+// history is a ring of the deltas of the most recently executed instructions.
+type history struct {
+	deltas []delta
+	// head is the index at which the next delta is recorded and size the number of deltas kept.
+	head int
+	size int
+}
+
+func (h *history) push(d delta) {
+	h.deltas[h.head] = d
+	h.head = (h.head + 1) % len(h.deltas)
+	h.size = min(h.size+1, len(h.deltas))
+}
+
+func (h *history) pop() (delta, bool) {
+	if h.size == 0 {
+		return delta{}, false
+	}
+	h.head = (h.head - 1 + len(h.deltas)) % len(h.deltas)
+	h.size--
+	return h.deltas[h.head], true
+}
+
+func (h *history) clear() {
+	h.head, h.size = 0, 0
+}
+
+// History returns the number of instructions that can currently be stepped back over.
+func (s *Simulator) History() int {
+	if s.history == nil {
+		return 0
+	}
+	return s.history.size
+}
+
+// StepBack undoes the most recently executed instruction, restoring the registers and RAM to what they were before it
+// executed. It fails with ErrNoHistory if the instruction is not kept in the history, which is always the case unless
+// Parameters.History is set. Keyboard input and the screen are not part of the history, the keyboard memory map is
+// overwritten by the next refresh.
+func (s *Simulator) StepBack() error {
+	_, err := s.undo()
+	return err
+}
+
+// RewindUntilWritten steps back until undoing an instruction that wrote to addr, leaving the simulator just before
+// that instruction executes. It fails with ErrNoHistory if no instruction kept in the history wrote to addr, in which
+// case the simulator is left at the oldest instruction kept. It returns the number of instructions stepped back over.
+func (s *Simulator) RewindUntilWritten(addr uint16) (int, error) {
+	for n := 1; ; n++ {
+		d, err := s.undo()
+		if err != nil {
+			return n - 1, err
+		}
+		if d.write && d.address == addr {
+			return n, nil
+		}
+	}
+}
+
+func (s *Simulator) undo() (delta, error) {
+	if s.history == nil {
+		return delta{}, errHistoryDisabled
+	}
+	d, ok := s.history.pop()
+	if !ok {
+		return delta{}, ErrNoHistory
+	}
+	s.cpu.a, s.cpu.d, s.cpu.pc = d.a, d.d, d.pc
+	if d.write {
+		s.ram[d.address] = d.old
+	}
+	s.cycles--
+	s.fault = nil
+	return d, nil
+}
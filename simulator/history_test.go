@@ -0,0 +1,85 @@
+package simulator
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSimulator_StepBack(t *testing.T) {
+	type state struct {
+		a, d, pc, sum, counter uint16
+		cycles                 uint64
+	}
+	capture := func(s *Simulator) state {
+		return state{a: s.A(), d: s.D(), pc: s.PC(), sum: s.Peek(0), counter: s.Peek(1), cycles: s.Cycles()}
+	}
+	s := New(Parameters{ROM: load(t, sum), History: 1000})
+	if err := s.StepBack(); !errors.Is(err, ErrNoHistory) {
+		t.Fatalf("expected %v before executing anything but got %v", ErrNoHistory, err)
+	}
+	states := []state{capture(s)}
+	for !s.Halted() {
+		if err := s.Step(); err != nil {
+			t.Fatal(err)
+		}
+		states = append(states, capture(s))
+	}
+	if s.History() != len(states)-1 {
+		t.Errorf("expected %d instructions of history but got %d", len(states)-1, s.History())
+	}
+	for i := len(states) - 2; i >= 0; i-- {
+		if err := s.StepBack(); err != nil {
+			t.Fatal(err)
+		}
+		if actual := capture(s); actual != states[i] {
+			t.Fatalf("expected state %+v after stepping back to cycle %d but got %+v", states[i], i, actual)
+		}
+	}
+	if err := s.StepBack(); !errors.Is(err, ErrNoHistory) {
+		t.Errorf("expected %v at the start of the program but got %v", ErrNoHistory, err)
+	}
+}
+
+func TestSimulator_StepBack_bounded(t *testing.T) {
+	s := New(Parameters{ROM: load(t, sum), History: 5})
+	s.RunCycles(20)
+	for range 5 {
+		if err := s.StepBack(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.StepBack(); !errors.Is(err, ErrNoHistory) {
+		t.Errorf("expected %v after stepping back 5 instructions but got %v", ErrNoHistory, err)
+	}
+	if s.Cycles() != 15 {
+		t.Errorf("expected to be back at cycle 15 but got %d", s.Cycles())
+	}
+	if err := New(Parameters{ROM: load(t, sum)}).StepBack(); !errors.Is(err, ErrNoHistory) || err == ErrNoHistory {
+		t.Errorf("expected %v telling that the history is disabled but got %v", ErrNoHistory, err)
+	}
+}
+
+func TestSimulator_RewindUntilWritten(t *testing.T) {
+	s := New(Parameters{ROM: load(t, sum), History: 1000})
+	s.RunCycles(1000)
+	n, err := s.RewindUntilWritten(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The last write to the sum adds the final counter value of 1.
+	if s.PC() != 11 || s.Peek(0) != 54 || s.Peek(1) != 1 {
+		t.Errorf("expected to stop before M=D+M at PC 11 with sum 54 but got PC %d with sum %d", s.PC(), s.Peek(0))
+	}
+	if n != 10 {
+		t.Errorf("expected to step back over 10 instructions but got %d", n)
+	}
+	if err := s.Step(); err != nil || s.Peek(0) != 55 {
+		t.Errorf("expected stepping forward again to write the final sum but got %d", s.Peek(0))
+	}
+	if _, err := s.RewindUntilWritten(100); !errors.Is(err, ErrNoHistory) {
+		t.Errorf("expected %v for an address never written but got %v", ErrNoHistory, err)
+	}
+	if s.Cycles() != 0 || s.PC() != 0 {
+		t.Errorf("expected to be left at the start of the program but got PC %d at cycle %d", s.PC(), s.Cycles())
+	}
+}
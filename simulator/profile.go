@@ -0,0 +1,326 @@
+package simulator
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/crookdc/nand2tetris/asm"
+	"io"
+	"slices"
+	"strings"
+)
+
+// hotAddresses is the number of ROM addresses listed in the flat report.
+const hotAddresses = 25
+
+// Profiler is a Tracer that counts the cycles spent at every ROM address. The cycles are also attributed to the
+// functions of the program when its debug information holds origins, as written for programs compiled from VM code,
+// or to the closest preceding label otherwise.
+//
+// Calls and returns are recognized from the functions that instructions belong to. Jumping to the first instruction
+// of a function is a call, and jumping to a return address label, which the VM translator names Function$ret.N, or
+// moving to a function further up the stack is a return. Instructions that belong to no function, such as shared call
+// and return routines, are attributed to the function on top of the stack.
+type Profiler struct {
+	debug  asm.Debug
+	cycles [32768]uint64
+	total  uint64
+	// names holds every function, owner the index in names of the function of every ROM address or -1 if it belongs
+	// to no function, entry whether a function begins at every ROM address and returns whether a return address label
+	// is declared at it.
+	names   []string
+	owner   []int
+	entry   []bool
+	returns []bool
+	// graph is set when functions are known from origins, otherwise calls are not tracked.
+	graph bool
+	// jump is set if the previous instruction has a jump field, in which case it jumped if the next instruction is at
+	// target.
+	jump   bool
+	target uint16
+	stack  []frame
+	self   []uint64
+	// inclusive holds the cycles spent in every function and the functions it called.
+	inclusive []uint64
+	calls     map[edge]*call
+}
+
+type frame struct {
+	function int
+	edge     edge
+	start    uint64
+}
+
+type edge struct {
+	caller int
+	callee int
+}
+
+type call struct {
+	count  uint64
+	cycles uint64
+}
+
+// NewProfiler returns a Profiler that describes the program using debug, which may be empty.
+func NewProfiler(debug asm.Debug) *Profiler {
+	p := Profiler{
+		debug:   debug,
+		owner:   make([]int, len(debug.Lines)),
+		entry:   make([]bool, len(debug.Lines)),
+		returns: make([]bool, len(debug.Lines)),
+		graph:   len(debug.Origins) > 0,
+		calls:   make(map[edge]*call),
+	}
+	index := make(map[string]int)
+	function := func(name string) int {
+		if i, ok := index[name]; ok {
+			return i
+		}
+		index[name] = len(p.names)
+		p.names = append(p.names, name)
+		return index[name]
+	}
+	// Without origins every address belongs to the closest label preceding it, ties broken alphabetically.
+	labels := make([]string, 0, len(debug.Labels))
+	for name := range debug.Labels {
+		labels = append(labels, name)
+	}
+	slices.SortFunc(labels, func(a, b string) int {
+		return cmp.Or(cmp.Compare(debug.Labels[a], debug.Labels[b]), cmp.Compare(b, a))
+	})
+	closest := -1
+	for addr := range p.owner {
+		p.owner[addr] = -1
+		if p.graph {
+			if addr < len(debug.Origins) && debug.Origins[addr].Function != "" {
+				p.owner[addr] = function(debug.Origins[addr].Function)
+			}
+			continue
+		}
+		for len(labels) > 0 && debug.Labels[labels[0]] <= addr {
+			closest = function(labels[0])
+			labels = labels[1:]
+		}
+		p.owner[addr] = closest
+	}
+	for name, addr := range debug.Labels {
+		if addr >= len(p.owner) {
+			continue
+		}
+		if i, ok := index[name]; ok && p.owner[addr] == i {
+			p.entry[addr] = true
+		}
+		if strings.Contains(name, "$ret.") {
+			p.returns[addr] = true
+		}
+	}
+	p.self = make([]uint64, len(p.names))
+	p.inclusive = make([]uint64, len(p.names))
+	return &p
+}
+
+func (p *Profiler) Trace(r Record) {
+	p.cycles[r.PC]++
+	p.total++
+	jumped := r.Cycle == 0 || (p.jump && r.PC == p.target)
+	p.jump, p.target = high(r.Instruction, 15) && r.Instruction&0b111 != 0, r.A
+	if int(r.PC) >= len(p.owner) {
+		return
+	}
+	fn := p.owner[r.PC]
+	if !p.graph {
+		if fn >= 0 {
+			p.self[fn]++
+		}
+		return
+	}
+	switch {
+	case fn < 0:
+	case len(p.stack) == 0:
+		p.stack = append(p.stack, frame{function: fn, edge: edge{caller: -1, callee: fn}, start: p.total - 1})
+	case p.entry[r.PC] && jumped:
+		p.enter(fn)
+	case p.returns[r.PC] && jumped && len(p.stack) > 1:
+		p.pop(p.total - 1)
+		if fn != p.top() {
+			p.leave(fn)
+		}
+	case fn != p.top():
+		p.leave(fn)
+	}
+	if len(p.stack) > 0 {
+		p.self[p.top()]++
+	}
+}
+
+func (p *Profiler) top() int {
+	return p.stack[len(p.stack)-1].function
+}
+
+func (p *Profiler) enter(fn int) {
+	e := edge{caller: p.top(), callee: fn}
+	c, ok := p.calls[e]
+	if !ok {
+		c = &call{}
+		p.calls[e] = c
+	}
+	c.count++
+	p.stack = append(p.stack, frame{function: fn, edge: e, start: p.total - 1})
+}
+
+// leave pops frames until fn is on top of the stack. If fn is not on the stack at all the program has moved on without
+// returning, such as when the bootstrap code is done, and fn replaces the top of the stack.
+func (p *Profiler) leave(fn int) {
+	i := len(p.stack) - 1
+	for i >= 0 && p.stack[i].function != fn {
+		i--
+	}
+	if i < 0 {
+		p.pop(p.total - 1)
+		p.stack = append(p.stack, frame{function: fn, edge: edge{caller: -1, callee: fn}, start: p.total - 1})
+		return
+	}
+	for len(p.stack) > i+1 {
+		p.pop(p.total - 1)
+	}
+}
+
+func (p *Profiler) pop(now uint64) {
+	f := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+	p.account(p.stack, f, now, p.inclusive, p.calls)
+}
+
+// account adds the cycles spent in frame f, which was called from the frames in stack, to inclusive and calls. Cycles
+// of recursive calls are only counted for the outermost call.
+func (p *Profiler) account(stack []frame, f frame, now uint64, inclusive []uint64, calls map[edge]*call) {
+	elapsed := now - f.start
+	if !slices.ContainsFunc(stack, func(g frame) bool { return g.function == f.function }) {
+		inclusive[f.function] += elapsed
+	}
+	if c, ok := calls[f.edge]; ok && !slices.ContainsFunc(stack, func(g frame) bool { return g.edge == f.edge }) {
+		c.cycles += elapsed
+	}
+}
+
+// finish returns the inclusive cycles and calls as they would be if every function on the stack returned now.
+func (p *Profiler) finish() ([]uint64, map[edge]call) {
+	inclusive := slices.Clone(p.inclusive)
+	pending := make(map[edge]*call, len(p.calls))
+	for e, c := range p.calls {
+		copied := *c
+		pending[e] = &copied
+	}
+	for i := len(p.stack) - 1; i >= 0; i-- {
+		p.account(p.stack[:i], p.stack[i], p.total, inclusive, pending)
+	}
+	calls := make(map[edge]call, len(pending))
+	for e, c := range pending {
+		calls[e] = *c
+	}
+	return inclusive, calls
+}
+
+// Cycles returns the number of cycles spent at addr.
+func (p *Profiler) Cycles(addr uint16) uint64 {
+	return p.cycles[addr%uint16(len(p.cycles))]
+}
+
+// WriteFlat writes the cycles spent in every function or label, excluding the functions they call, followed by the
+// most frequently executed ROM addresses.
+func (p *Profiler) WriteFlat(w io.Writer) error {
+	pw := printer{w: w}
+	pw.printf("flat profile of %d cycles\n", p.total)
+	if len(p.names) > 0 {
+		pw.printf("\n%12s %7s  %s\n", "self", "%", "function")
+		for _, fn := range p.ranked(p.self) {
+			pw.printf("%12d %6.2f%%  %s\n", p.self[fn], p.percent(p.self[fn]), p.names[fn])
+		}
+	}
+	addresses := make([]int, 0)
+	for addr, n := range p.cycles {
+		if n > 0 {
+			addresses = append(addresses, addr)
+		}
+	}
+	slices.SortStableFunc(addresses, func(a, b int) int {
+		return cmp.Compare(p.cycles[b], p.cycles[a])
+	})
+	pw.printf("\n%12s %7s  %s\n", "cycles", "%", "address")
+	for _, addr := range addresses[:min(len(addresses), hotAddresses)] {
+		str := p.debug.Describe(addr)
+		if _, _, ok := p.debug.Label(addr); ok {
+			str = fmt.Sprintf("%d %s", addr, str)
+		}
+		if addr < len(p.debug.Origins) {
+			str = fmt.Sprintf("%s in %s", str, p.debug.Origins[addr])
+		}
+		pw.printf("%12d %6.2f%%  %s\n", p.cycles[addr], p.percent(p.cycles[addr]), str)
+	}
+	return pw.err
+}
+
+// WriteCallGraph writes every function along with the cycles spent in it including the functions it calls, the
+// functions it was called by and the functions that it calls. It writes nothing unless origins are known.
+func (p *Profiler) WriteCallGraph(w io.Writer) error {
+	if !p.graph {
+		return nil
+	}
+	inclusive, calls := p.finish()
+	edges := make([]edge, 0, len(calls))
+	for e := range calls {
+		edges = append(edges, e)
+	}
+	slices.SortFunc(edges, func(a, b edge) int {
+		return cmp.Or(cmp.Compare(calls[b].cycles, calls[a].cycles), cmp.Compare(p.names[a.callee], p.names[b.callee]))
+	})
+	pw := printer{w: w}
+	pw.printf("call graph of %d cycles\n", p.total)
+	for _, fn := range p.ranked(inclusive) {
+		pw.printf("\n%s  total %d (%.2f%%)  self %d (%.2f%%)\n",
+			p.names[fn], inclusive[fn], p.percent(inclusive[fn]), p.self[fn], p.percent(p.self[fn]))
+		for _, e := range edges {
+			if e.callee == fn {
+				pw.printf("    called by %s %d times\n", p.names[e.caller], calls[e].count)
+			}
+		}
+		for _, e := range edges {
+			if e.caller == fn {
+				pw.printf("    calls %s %d times, %d cycles\n", p.names[e.callee], calls[e].count, calls[e].cycles)
+			}
+		}
+	}
+	return pw.err
+}
+
+// ranked returns the functions that have spent any cycles according to cycles, sorted by those cycles.
+func (p *Profiler) ranked(cycles []uint64) []int {
+	fns := make([]int, 0, len(cycles))
+	for fn, n := range cycles {
+		if n > 0 {
+			fns = append(fns, fn)
+		}
+	}
+	slices.SortFunc(fns, func(a, b int) int {
+		return cmp.Or(cmp.Compare(cycles[b], cycles[a]), cmp.Compare(p.names[a], p.names[b]))
+	})
+	return fns
+}
+
+func (p *Profiler) percent(n uint64) float64 {
+	if p.total == 0 {
+		return 0
+	}
+	return float64(n) / float64(p.total) * 100
+}
+
+// printer remembers the first error met while printing.
+type printer struct {
+	w   io.Writer
+	err error
+}
+
+func (p *printer) printf(format string, args ...any) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, args...)
+	}
+}
@@ -0,0 +1,125 @@
+package simulator
+
+import (
+	"github.com/crookdc/nand2tetris/asm"
+	"strings"
+	"testing"
+)
+
+// caller calls Math.double twice using a calling convention like that of the VM translator, with the argument in R13
+// and the return address in R14.
+var caller = []string{
+	"@3", "D=A", "@R13", "M=D",
+	"@Main.main$ret.0", "D=A", "@R14", "M=D", "@Math.double", "0;JMP", "(Main.main$ret.0)",
+	"@Main.main$ret.1", "D=A", "@R14", "M=D", "@Math.double", "0;JMP", "(Main.main$ret.1)",
+	"(END)", "@END", "0;JMP",
+	"(Math.double)", "@R13", "D=M", "M=D+M", "@R14", "A=M", "0;JMP",
+}
+
+func profile(t *testing.T, origins bool) *Profiler {
+	generated := make([]asm.Origin, len(caller))
+	for i := range caller {
+		generated[i] = asm.Origin{Function: "Main.main", Command: "call Math.double 1"}
+		if i >= 21 {
+			generated[i] = asm.Origin{Function: "Math.double", Command: "return"}
+		}
+	}
+	program, debug, err := asm.AssembleGenerated("Main.asm", caller, generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !origins {
+		debug.Origins = nil
+	}
+	p := NewProfiler(debug)
+	s := New(Parameters{ROM: load(t, strings.Join(caller, "\n")), Tracer: p})
+	if n := s.RunCycles(100); n != 29 {
+		t.Fatalf("expected the program to halt after 29 cycles but ran %d", n)
+	}
+	if len(program) != 24 {
+		t.Fatalf("expected 24 instructions but got %d", len(program))
+	}
+	return p
+}
+
+func TestProfiler_WriteCallGraph(t *testing.T) {
+	var sb strings.Builder
+	if err := profile(t, true).WriteCallGraph(&sb); err != nil {
+		t.Fatal(err)
+	}
+	expected := `call graph of 29 cycles
+
+Main.main  total 29 (100.00%)  self 17 (58.62%)
+    calls Math.double 2 times, 12 cycles
+
+Math.double  total 12 (41.38%)  self 12 (41.38%)
+    called by Main.main 2 times
+`
+	if sb.String() != expected {
+		t.Errorf("expected\n%s\nbut got\n%s", expected, sb.String())
+	}
+}
+
+func TestProfiler_WriteFlat(t *testing.T) {
+	tests := []struct {
+		name     string
+		origins  bool
+		expected []string
+	}{
+		{
+			name:    "functions",
+			origins: true,
+			expected: []string{
+				"flat profile of 29 cycles",
+				"",
+				"        self       %  function",
+				"          17  58.62%  Main.main",
+				"          12  41.38%  Math.double",
+				"",
+				"      cycles       %  address",
+				"           2   6.90%  18 Math.double (Main.asm:23) in Math.double: return",
+			},
+		},
+		{
+			name: "labels",
+			expected: []string{
+				"flat profile of 29 cycles",
+				"",
+				"        self       %  function",
+				"          12  41.38%  Math.double",
+				"           6  20.69%  Main.main$ret.0",
+				"           1   3.45%  END",
+				"",
+				"      cycles       %  address",
+				"           2   6.90%  18 Math.double (Main.asm:23)",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := profile(t, test.origins)
+			var sb strings.Builder
+			if err := p.WriteFlat(&sb); err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(sb.String(), "\n")
+			if strings.Join(lines[:len(test.expected)], "\n") != strings.Join(test.expected, "\n") {
+				t.Errorf("expected report to begin with\n%s\nbut got\n%s", strings.Join(test.expected, "\n"), sb.String())
+			}
+			if p.Cycles(18) != 2 || p.Cycles(0) != 1 {
+				t.Errorf("expected 2 cycles at address 18 and 1 at address 0")
+			}
+		})
+	}
+	t.Run("unknown", func(t *testing.T) {
+		p := NewProfiler(asm.Debug{})
+		New(Parameters{ROM: load(t, sum), Tracer: p}).RunCycles(1000)
+		var sb strings.Builder
+		if err := p.WriteFlat(&sb); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(sb.String(), "flat profile of 111 cycles\n\n      cycles       %  address\n          11   9.91%  6\n") {
+			t.Errorf("unexpected report\n%s", sb.String())
+		}
+	})
+}
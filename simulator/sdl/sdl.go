@@ -148,6 +148,10 @@ func (s *Screen) Close() {
 	_ = s.window.Destroy()
 }
 
+// SnapshotKey is the key that calls the function registered with Keyboard.OnSnapshot, it is never passed on to the
+// program.
+const SnapshotKey sdl.Keycode = sdl.K_F5
+
 func NewKeyboard() *Keyboard {
 	return &Keyboard{
 		capitalize: false,
@@ -157,12 +161,25 @@ func NewKeyboard() *Keyboard {
 type Keyboard struct {
 	capitalize bool
 	current    uint16
+	snapshot   func()
+}
+
+// OnSnapshot registers fn to be called when SnapshotKey is pressed. It is called from Poll, in between the
+// instructions of the program.
+func (k *Keyboard) OnSnapshot(fn func()) {
+	k.snapshot = fn
 }
 
 func (k *Keyboard) Poll() uint16 {
 	for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
 		switch e := event.(type) {
 		case *sdl.KeyboardEvent:
+			if e.Keysym.Sym == SnapshotKey {
+				if e.State == sdl.PRESSED && e.Repeat == 0 && k.snapshot != nil {
+					k.snapshot()
+				}
+				continue
+			}
 			if e.State == sdl.RELEASED {
 				k.current = 0
 				continue
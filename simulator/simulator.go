@@ -1,6 +1,9 @@
 package simulator
 
 import (
+	"context"
+	"errors"
+	"github.com/crookdc/nand2tetris/asm"
 	"time"
 )
 
@@ -9,6 +12,13 @@ var (
 	KeyboardMemoryMapAddress        = 24_576
 )
 
+var (
+	// ErrHalted is returned by RunUntil when the program halts before the condition is met.
+	ErrHalted = errors.New("program has halted")
+	// ErrCycleLimit is returned by RunUntil when the condition is not met within the cycle limit.
+	ErrCycleLimit = errors.New("cycle limit reached")
+)
+
 func Must[T any](v T, err error) T {
 	if err != nil {
 		panic(err)
@@ -37,24 +47,72 @@ type Keyboard interface {
 	Poll() uint16
 }
 
+// Parameters configures a Simulator. Screen and Keyboard may be left nil to run the simulator headless, in which case
+// NullScreen and NullKeyboard are used.
 type Parameters struct {
 	Screen   Screen
 	Keyboard Keyboard
 	ROM      []uint16
+	// ISA is the instruction set that the ROM is executed as, the standard instruction set if left empty.
+	ISA asm.ISA
+	// ClockRate is the number of instructions per second that Run aims to execute. Run executes instructions as fast as
+	// it can if ClockRate is zero.
+	ClockRate int
+	// Tracer, if not nil, receives a Record of every instruction executed.
+	Tracer Tracer
+	// History is the number of most recently executed instructions that are remembered so that they can be undone by
+	// StepBack and RewindUntilWritten. Nothing is remembered if zero.
+	History int
+	// RefreshInterval is the number of instructions that Run executes between refreshes of the screen and keyboard.
+	// If zero, Run refreshes 30 times per second of simulated time, or every DefaultRefreshInterval instructions when
+	// unthrottled.
+	RefreshInterval int
 }
 
+const (
+	// DefaultClockRate is the clock rate of the Hack computer as simulated by cmd/hack.
+	DefaultClockRate = 3_000_000
+	// DefaultRefreshInterval is the number of instructions executed between refreshes when running unthrottled.
+	DefaultRefreshInterval = 1_000_000
+	// refreshRate is the number of refreshes per second of simulated time.
+	refreshRate = 30
+)
+
 func New(params Parameters) *Simulator {
 	var rom [32768]uint16
 	for i := range params.ROM {
 		rom[i] = params.ROM[i]
 	}
-	return &Simulator{
+	if params.Screen == nil {
+		params.Screen = NullScreen{}
+	}
+	if params.Keyboard == nil {
+		params.Keyboard = NullKeyboard{}
+	}
+	interval := params.RefreshInterval
+	if interval <= 0 {
+		interval = DefaultRefreshInterval
+		if params.ClockRate > 0 {
+			interval = max(params.ClockRate/refreshRate, 1)
+		}
+	}
+	s := &Simulator{
 		screen:   params.Screen,
 		keyboard: params.Keyboard,
 		rom:      rom,
 		ram:      [32768]uint16{},
-		cpu:      cpu{},
+		cpu:      cpu{extended: params.ISA == asm.Extended},
+		rate:     params.ClockRate,
+		interval: interval,
+		tracer:   params.Tracer,
 	}
+	if params.History > 0 {
+		s.history = &history{deltas: make([]delta, params.History)}
+	}
+	for i, word := range s.rom {
+		s.decoded[i] = decode(word, s.cpu.extended)
+	}
+	return s
 }
 
 type Simulator struct {
@@ -63,35 +121,224 @@ type Simulator struct {
 	rom      [32768]uint16
 	ram      [32768]uint16
 	cpu      cpu
+	// decoded holds the instruction at every ROM address decoded ahead of time.
+	decoded [32768]instruction
+	// fault is the error that stopped the program, if an illegal instruction was met.
+	fault error
+	// cycles is the number of instructions executed since the simulator was created.
+	cycles uint64
+	// rate is the target clock rate of Run and interval the number of instructions between refreshes.
+	rate     int
+	interval int
+	tracer   Tracer
+	history  *history
 }
 
+// Run executes the program until refreshing the screen or keyboard fails or an illegal instruction is met. It never
+// returns otherwise.
 func (s *Simulator) Run() error {
-	external := time.Tick(time.Second / 33)
-	internal := time.Tick(time.Second / 3000000)
+	return s.RunContext(context.Background())
+}
+
+// RunContext executes the program in batches of instructions, refreshing the screen and keyboard after every batch,
+// until ctx is done, refreshing fails or an illegal instruction is met. Between batches it sleeps for as long as it is
+// ahead of the clock rate. When the program falls behind by more than a batch, for instance because the host cannot
+// keep up, the lost time is forgiven rather than made up for in a burst. A halted program is still refreshed 30 times
+// per second so that the screen stays responsive.
+func (s *Simulator) RunContext(ctx context.Context) error {
+	start, executed := time.Now(), 0
+	batch := time.Duration(0)
+	if s.rate > 0 {
+		batch = time.Duration(float64(s.interval) / float64(s.rate) * float64(time.Second))
+	}
 	for {
-		select {
-		case _ = <-external:
-			if err := s.draw(); err != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n := s.RunCycles(s.interval)
+		if err := s.Refresh(); err != nil {
+			return err
+		}
+		if s.fault != nil {
+			return s.fault
+		}
+		if n < s.interval {
+			// The program has halted, there is nothing to keep pace with.
+			if err := sleep(ctx, time.Second/refreshRate); err != nil {
 				return err
 			}
-			s.ram[KeyboardMemoryMapAddress] = s.keyboard.Poll()
-		case _ = <-internal:
-			s.tick()
-		default:
+			start, executed = time.Now(), 0
+			continue
+		}
+		if s.rate <= 0 {
+			continue
+		}
+		executed += n
+		ahead := time.Duration(float64(executed)/float64(s.rate)*float64(time.Second)) - time.Since(start)
+		switch {
+		case ahead > 0:
+			if err := sleep(ctx, ahead); err != nil {
+				return err
+			}
+		case ahead < -batch:
+			start, executed = time.Now(), 0
 		}
 	}
 }
 
-func (s *Simulator) tick() {
-	instruction := s.rom[s.cpu.pc]
-	address := s.cpu.address()
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Cycles returns the number of instructions executed since the simulator was created.
+func (s *Simulator) Cycles() uint64 {
+	return s.cycles
+}
+
+// Refresh polls the keyboard into its memory map and draws the screen memory map. Run refreshes periodically while
+// headless callers of Step, RunCycles and RunUntil decide for themselves when to refresh.
+func (s *Simulator) Refresh() error {
+	s.ram[KeyboardMemoryMapAddress] = s.keyboard.Poll()
+	return s.draw()
+}
+
+// Step executes the instruction at the current program counter. It fails with an *IllegalInstructionError, leaving
+// the simulator unchanged, if the instruction does not encode a computation.
+func (s *Simulator) Step() error {
+	return s.tick()
+}
+
+// Err returns the *IllegalInstructionError that stopped the program, or nil if it has not met an illegal instruction.
+func (s *Simulator) Err() error {
+	return s.fault
+}
+
+// RunCycles executes up to n instructions, stopping early if the program halts or meets an illegal instruction, which
+// is then returned by Err. It returns the number of instructions executed.
+func (s *Simulator) RunCycles(n int) int {
+	for i := range n {
+		if s.Halted() {
+			return i
+		}
+		if err := s.tick(); err != nil {
+			return i
+		}
+	}
+	return n
+}
+
+// RunUntil executes instructions until cond is satisfied, which is checked before every instruction. It fails with
+// ErrHalted if the program halts first, with an *IllegalInstructionError if it meets an illegal instruction and with
+// ErrCycleLimit if cond is not satisfied within limit instructions. It returns the number of instructions executed.
+func (s *Simulator) RunUntil(cond func(*Simulator) bool, limit int) (int, error) {
+	for i := range limit {
+		if cond(s) {
+			return i, nil
+		}
+		if s.fault != nil {
+			return i, s.fault
+		}
+		if s.Halted() {
+			return i, ErrHalted
+		}
+		if err := s.tick(); err != nil {
+			return i, err
+		}
+	}
+	if cond(s) {
+		return limit, nil
+	}
+	return limit, ErrCycleLimit
+}
+
+// Halted reports whether the program has halted, which Hack programs do by entering an infinite loop that jumps to
+// itself. Both the canonical (END) @END 0;JMP and an unconditional jump to the jump itself are detected. A program that
+// has met an illegal instruction is halted as well.
+func (s *Simulator) Halted() bool {
+	if s.fault != nil {
+		return true
+	}
+	pc := s.cpu.pc
+	ins := s.rom[pc]
+	if low(ins, 15) || ins&0b111 != jmp {
+		return false
+	}
+	if s.cpu.address() == pc {
+		return true
+	}
+	return pc > 0 && s.cpu.address() == pc-1 && s.rom[pc-1] == pc-1
+}
+
+// A returns the value of the A register.
+func (s *Simulator) A() uint16 {
+	return s.cpu.a
+}
+
+// D returns the value of the D register.
+func (s *Simulator) D() uint16 {
+	return s.cpu.d
+}
+
+// ROM returns the instruction stored at addr in ROM.
+func (s *Simulator) ROM(addr uint16) uint16 {
+	return s.rom[addr%uint16(len(s.rom))]
+}
+
+// PC returns the address of the next instruction to execute.
+func (s *Simulator) PC() uint16 {
+	return s.cpu.pc
+}
+
+// Peek returns the word stored at addr in RAM.
+func (s *Simulator) Peek(addr uint16) uint16 {
+	return s.ram[addr%uint16(len(s.ram))]
+}
+
+// Poke stores value at addr in RAM.
+func (s *Simulator) Poke(addr uint16, value uint16) {
+	s.ram[addr%uint16(len(s.ram))] = value
+}
+
+func (s *Simulator) tick() error {
+	ins := s.decoded[s.cpu.pc]
+	if !ins.legal() {
+		s.fault = &IllegalInstructionError{PC: s.cpu.pc, Instruction: s.rom[s.cpu.pc]}
+		return s.fault
+	}
+	pc, address := s.cpu.pc, s.cpu.address()
 	s.cpu.m = s.ram[address]
-	if w := s.cpu.execute(instruction); w {
+	if s.history != nil {
+		s.history.push(delta{a: s.cpu.a, d: s.cpu.d, pc: pc, write: ins.writes(), address: address, old: s.cpu.m})
+	}
+	w := s.cpu.run(ins)
+	if w {
 		s.ram[address] = s.cpu.m
 	}
+	if s.tracer != nil {
+		r := Record{Cycle: s.cycles, PC: pc, Instruction: s.rom[pc], A: s.cpu.a, D: s.cpu.d}
+		if w {
+			r.Write, r.Address, r.Value = true, address, s.cpu.m
+		}
+		s.tracer.Trace(r)
+	}
+	s.cycles++
+	return nil
 }
 
 func (s *Simulator) draw() error {
+	return Draw(s.screen, s.ram[:])
+}
+
+// Draw presents the screen memory map of ram on screen. Every bit of the memory map is a pixel, cleared bits being
+// drawn black and set bits white.
+func Draw(screen Screen, ram []uint16) error {
 	black, white := make([]Point, 0), make([]Point, 0)
 
 	for y := range 256 {
@@ -100,20 +347,20 @@ func (s *Simulator) draw() error {
 				X: uint16(x),
 				Y: uint16(y),
 			}
-			if low(s.ram[int(ScreenMemoryMapBegin)+y*32+x/16], x%16) {
+			if low(ram[int(ScreenMemoryMapBegin)+y*32+x/16], x%16) {
 				black = append(black, point)
 			} else {
 				white = append(white, point)
 			}
 		}
 	}
-	if err := s.screen.Fill(Color{255, 255, 255}, white...); err != nil {
+	if err := screen.Fill(Color{255, 255, 255}, white...); err != nil {
 		return err
 	}
-	if err := s.screen.Fill(Color{0, 0, 0}, black...); err != nil {
+	if err := screen.Fill(Color{0, 0, 0}, black...); err != nil {
 		return err
 	}
-	s.screen.Present()
+	screen.Present()
 	return nil
 }
 
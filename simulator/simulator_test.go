@@ -1,8 +1,12 @@
 package simulator
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/crookdc/nand2tetris/asm"
 	"testing"
+	"time"
 )
 
 func TestHigh(t *testing.T) {
@@ -31,3 +35,282 @@ func TestHigh(t *testing.T) {
 		})
 	}
 }
+
+func load(t testing.TB, src string) []uint16 {
+	program, err := asm.Assemble(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rom := make([]uint16, len(program))
+	for i, ins := range program {
+		for _, bit := range ins {
+			rom[i] = rom[i]<<1 | uint16(bit)
+		}
+	}
+	return rom
+}
+
+const sum = `
+@0
+M=0
+@10
+D=A
+@1
+M=D
+(LOOP)
+@1
+D=M
+@END
+D;JEQ
+@0
+M=D+M
+@1
+M=M-1
+@LOOP
+0;JMP
+(END)
+@END
+0;JMP
+`
+
+func TestSimulator_RunCycles(t *testing.T) {
+	s := New(Parameters{ROM: load(t, sum)})
+	if n := s.RunCycles(6); n != 6 {
+		t.Errorf("expected 6 cycles but got %d", n)
+	}
+	if s.Peek(1) != 10 || s.PC() != 6 {
+		t.Errorf("expected counter 10 at PC 6 but got %d at PC %d", s.Peek(1), s.PC())
+	}
+	n := s.RunCycles(1000)
+	if n >= 1000 || !s.Halted() {
+		t.Fatalf("expected program to halt within 1000 cycles but ran %d", n)
+	}
+	if s.Peek(0) != 55 {
+		t.Errorf("expected sum 55 but got %d", s.Peek(0))
+	}
+	if n := s.RunCycles(10); n != 0 {
+		t.Errorf("expected a halted program to run 0 cycles but ran %d", n)
+	}
+}
+
+func TestSimulator_RunUntil(t *testing.T) {
+	s := New(Parameters{ROM: load(t, sum)})
+	_, err := s.RunUntil(func(s *Simulator) bool {
+		return s.Peek(0) >= 30
+	}, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Peek(0) != 34 {
+		t.Errorf("expected to stop at sum 34 but got %d", s.Peek(0))
+	}
+	if _, err := s.RunUntil(func(s *Simulator) bool { return false }, 5); !errors.Is(err, ErrCycleLimit) {
+		t.Errorf("expected %v but got %v", ErrCycleLimit, err)
+	}
+	if _, err := s.RunUntil(func(s *Simulator) bool { return false }, 1000); !errors.Is(err, ErrHalted) {
+		t.Errorf("expected %v but got %v", ErrHalted, err)
+	}
+}
+
+func TestSimulator_illegalInstruction(t *testing.T) {
+	rom := []uint16{0b0000_0000_0000_0111, 0b1110_1100_0001_0000, 0b1111_1111_1101_0000, 0}
+	expected := "illegal instruction 1111111111010000 at PC 2"
+	s := New(Parameters{ROM: rom})
+	n, err := s.RunUntil(func(*Simulator) bool { return false }, 10)
+	var illegal *IllegalInstructionError
+	if !errors.As(err, &illegal) || err.Error() != expected {
+		t.Fatalf("expected %q but got %v", expected, err)
+	}
+	if n != 2 || s.Cycles() != 2 || s.PC() != 2 || s.D() != 7 {
+		t.Errorf("expected to stop at PC 2 after 2 cycles with D=7 but got PC %d after %d cycles", s.PC(), n)
+	}
+	if !s.Halted() || s.Err() != err {
+		t.Error("expected the simulator to be halted by the illegal instruction")
+	}
+	if err := s.Step(); err == nil || err.Error() != expected {
+		t.Errorf("expected stepping to fail with %q again but got %v", expected, err)
+	}
+	if n := New(Parameters{ROM: rom}).RunCycles(10); n != 2 {
+		t.Errorf("expected 2 cycles but got %d", n)
+	}
+}
+
+func TestSimulator_negativeAddress(t *testing.T) {
+	// The VM translator pops into a segment by computing A=D-A while A holds the popped value, which may be negative.
+	src := `
+@3
+D=A
+@32767
+D=D+A
+A=D
+D=M
+@5
+M=D
+A=-1
+0;JMP
+`
+	s := New(Parameters{ROM: load(t, src)})
+	s.Poke(2, 42)
+	n := s.RunCycles(10)
+	if n != 10 || s.Err() != nil {
+		t.Fatalf("expected 10 cycles without errors but got %d: %v", n, s.Err())
+	}
+	// Only the 15 least significant bits of A address memory, so 32770 addresses RAM[2] and -1 addresses ROM[32767].
+	if s.Peek(5) != 42 {
+		t.Errorf("expected RAM[5] to be 42 but got %d", s.Peek(5))
+	}
+	if s.PC() != 32767 {
+		t.Errorf("expected PC 32767 but got %d", s.PC())
+	}
+}
+
+func TestSimulator_Halted(t *testing.T) {
+	tests := []struct {
+		src    string
+		cycles int
+		halted bool
+	}{
+		{src: "(END)\n@END\n0;JMP", cycles: 1, halted: true},
+		{src: "@1\n0;JMP", cycles: 1, halted: true},
+		{src: "(LOOP)\n@LOOP\nD;JEQ", cycles: 1, halted: false},
+		{src: "@3\n0;JMP\n@0\n@0", cycles: 1, halted: false},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			s := New(Parameters{ROM: load(t, test.src)})
+			s.RunCycles(test.cycles)
+			if s.Halted() != test.halted {
+				t.Errorf("expected halted to be %v", test.halted)
+			}
+		})
+	}
+}
+
+func TestSimulator_Refresh(t *testing.T) {
+	screen := &MemoryScreen{}
+	keyboard := &MemoryKeyboard{Key: 'a'}
+	s := New(Parameters{
+		Screen:   screen,
+		Keyboard: keyboard,
+		ROM:      load(t, "@16384\nM=-1\n@24576\nD=M\n@0\nM=D\n(END)\n@END\n0;JMP"),
+	})
+	if err := s.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	s.RunCycles(100)
+	if err := s.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Peek(0) != 'a' {
+		t.Errorf("expected the polled key to be read but got %d", s.Peek(0))
+	}
+	if screen.Frames != 2 {
+		t.Errorf("expected 2 frames but got %d", screen.Frames)
+	}
+	if screen.Pixel(0, 0) != screen.Pixel(15, 0) || screen.Pixel(15, 0) == screen.Pixel(16, 0) {
+		t.Error("expected the first 16 pixels to be drawn differently from the rest")
+	}
+}
+
+// counter increments RAM[0] forever.
+const counter = `
+(LOOP)
+@0
+M=M+1
+@LOOP
+0;JMP
+`
+
+// multiply computes RAM[0] times RAM[1] into RAM[2] by repeated addition, over and over again.
+const multiply = `
+@123
+D=A
+@0
+M=D
+@45
+D=A
+@1
+M=D
+(RESTART)
+@2
+M=0
+@1
+D=M
+@3
+M=D
+(LOOP)
+@3
+D=M
+@RESTART
+D;JEQ
+@0
+D=M
+@2
+M=D+M
+@3
+M=M-1
+@LOOP
+0;JMP
+`
+
+func TestSimulator_RunContext(t *testing.T) {
+	t.Run("unthrottled", func(t *testing.T) {
+		screen := &MemoryScreen{}
+		s := New(Parameters{Screen: screen, ROM: load(t, counter), RefreshInterval: 10_000})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := s.RunContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected %v but got %v", context.DeadlineExceeded, err)
+		}
+		if s.Cycles() == 0 || s.Cycles()%10_000 != 0 {
+			t.Errorf("expected a whole number of batches to be executed but got %d cycles", s.Cycles())
+		}
+		if uint64(screen.Frames) != s.Cycles()/10_000 {
+			t.Errorf("expected a refresh after every batch but got %d frames in %d cycles", screen.Frames, s.Cycles())
+		}
+		if uint16(s.Cycles()/4) != s.Peek(0) {
+			t.Errorf("expected the counter to be incremented every 4 cycles but got %d in %d cycles", s.Peek(0), s.Cycles())
+		}
+	})
+	t.Run("throttled", func(t *testing.T) {
+		s := New(Parameters{ROM: load(t, counter), ClockRate: 100_000, RefreshInterval: 1_000})
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if err := s.RunContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected %v but got %v", context.DeadlineExceeded, err)
+		}
+		if limit := uint64(time.Since(start).Seconds()*100_000) + 1_000; s.Cycles() > limit {
+			t.Errorf("expected at most %d cycles at 100kHz but got %d", limit, s.Cycles())
+		}
+		if s.Cycles() < 1_000 {
+			t.Errorf("expected at least one batch to be executed but got %d cycles", s.Cycles())
+		}
+	})
+	t.Run("halted", func(t *testing.T) {
+		s := New(Parameters{ROM: load(t, sum)})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := s.RunContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected %v but got %v", context.DeadlineExceeded, err)
+		}
+		if !s.Halted() || s.Peek(0) != 55 {
+			t.Errorf("expected the program to halt with sum 55 but got %d", s.Peek(0))
+		}
+	})
+}
+
+func BenchmarkSimulator_RunCycles(b *testing.B) {
+	programs := map[string]string{"counter": counter, "multiply": multiply}
+	for _, name := range []string{"counter", "multiply"} {
+		b.Run(name, func(b *testing.B) {
+			s := New(Parameters{ROM: load(b, programs[name])})
+			const batch = 1_000_000
+			b.ResetTimer()
+			for range b.N {
+				s.RunCycles(batch)
+			}
+			b.ReportMetric(float64(b.N)*batch/b.Elapsed().Seconds(), "instructions/s")
+		})
+	}
+}
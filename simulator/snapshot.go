@@ -0,0 +1,98 @@
+package simulator
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	snapshotMagic   = "HSNP"
+	snapshotVersion = 1
+	// snapshotExtended is the flag set in snapshots of simulators that execute the extended instruction set.
+	snapshotExtended = 1
+)
+
+// snapshot is the state of the machine as it is stored by Save, following the magic bytes and version.
+type snapshot struct {
+	Flags  uint8
+	A      uint16
+	D      uint16
+	PC     uint16
+	Cycles uint64
+	ROM    [32768]uint16
+	RAM    [32768]uint16
+}
+
+// Save writes a snapshot of the machine to w, holding the ROM, RAM, registers and cycle counter as well as whether
+// the extended instruction set is executed. The snapshot starts with the magic bytes HSNP and a version byte,
+// followed by the state with every word written in big endian order.
+func (s *Simulator) Save(w io.Writer) error {
+	snap := snapshot{
+		A:      s.cpu.a,
+		D:      s.cpu.d,
+		PC:     s.cpu.pc,
+		Cycles: s.cycles,
+		ROM:    s.rom,
+		RAM:    s.ram,
+	}
+	if s.cpu.extended {
+		snap.Flags |= snapshotExtended
+	}
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(snapshotMagic); err != nil {
+		return err
+	}
+	if err := bw.WriteByte(snapshotVersion); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.BigEndian, &snap); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Restore replaces the state of the machine with a snapshot written by Save. The machine is left unchanged if the
+// snapshot cannot be read. Restoring clears any illegal instruction met before as well as the history.
+func (s *Simulator) Restore(r io.Reader) error {
+	br := bufio.NewReader(r)
+	var header [5]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return fmt.Errorf("reading snapshot header: %w", err)
+	}
+	if string(header[:4]) != snapshotMagic {
+		return errors.New("not a snapshot")
+	}
+	if header[4] != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", header[4])
+	}
+	var snap snapshot
+	if err := binary.Read(br, binary.BigEndian, &snap); err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+	if snap.Flags&^snapshotExtended != 0 {
+		return fmt.Errorf("unsupported snapshot flags %08b", snap.Flags)
+	}
+	if snap.PC > addressMask {
+		return fmt.Errorf("program counter %d is out of range", snap.PC)
+	}
+	s.cpu = cpu{
+		a:        snap.A,
+		d:        snap.D,
+		pc:       snap.PC,
+		extended: snap.Flags&snapshotExtended != 0,
+	}
+	s.cycles = snap.Cycles
+	s.rom = snap.ROM
+	s.ram = snap.RAM
+	s.fault = nil
+	if s.history != nil {
+		s.history.clear()
+	}
+	for i, word := range s.rom {
+		s.decoded[i] = decode(word, s.cpu.extended)
+	}
+	return nil
+}
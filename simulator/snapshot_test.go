@@ -0,0 +1,73 @@
+package simulator
+
+import (
+	"bytes"
+	"github.com/crookdc/nand2tetris/asm"
+	"strings"
+	"testing"
+)
+
+func TestSimulator_Restore(t *testing.T) {
+	s := New(Parameters{ROM: load(t, sum)})
+	s.RunCycles(40)
+	var buf bytes.Buffer
+	if err := s.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	snap := buf.Bytes()
+
+	restored := New(Parameters{ISA: asm.Extended})
+	if err := restored.Restore(bytes.NewReader(snap)); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Cycles() != 40 || restored.PC() != s.PC() || restored.A() != s.A() || restored.D() != s.D() {
+		t.Errorf("expected registers and cycles to be restored")
+	}
+	if restored.cpu.extended {
+		t.Errorf("expected the instruction set to be restored")
+	}
+	s.RunCycles(1000)
+	restored.RunCycles(1000)
+	if !restored.Halted() || restored.Peek(0) != 55 || restored.Cycles() != s.Cycles() {
+		t.Errorf("expected the restored program to halt with sum 55 after %d cycles but got %d after %d", s.Cycles(), restored.Peek(0), restored.Cycles())
+	}
+
+	// A snapshot restores the state it was taken in, regardless of what ran in between.
+	if err := s.Restore(bytes.NewReader(snap)); err != nil {
+		t.Fatal(err)
+	}
+	if s.Halted() || s.Cycles() != 40 {
+		t.Errorf("expected to be back at cycle 40 but got %d", s.Cycles())
+	}
+}
+
+func TestSimulator_Restore_errors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := New(Parameters{ROM: load(t, sum)}).Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	snap := buf.String()
+	tests := []struct {
+		snapshot string
+		expected string
+	}{
+		{snapshot: "HSN", expected: "reading snapshot header: unexpected EOF"},
+		{snapshot: "HTRC\x01", expected: "not a snapshot"},
+		{snapshot: "HSNP\x02" + snap[5:], expected: "unsupported snapshot version 2"},
+		{snapshot: snap[:len(snap)-1], expected: "reading snapshot: unexpected EOF"},
+		{snapshot: "HSNP\x01\x80" + snap[6:], expected: "unsupported snapshot flags 10000000"},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			s := New(Parameters{ROM: load(t, "@7\nD=A")})
+			s.Step()
+			err := s.Restore(strings.NewReader(test.snapshot))
+			if err == nil || err.Error() != test.expected {
+				t.Errorf("expected error %q but got %v", test.expected, err)
+			}
+			if s.A() != 7 || s.PC() != 1 || s.Cycles() != 1 {
+				t.Errorf("expected the simulator to be left unchanged")
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package simulator
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Record describes the execution of a single instruction.
+type Record struct {
+	// Cycle counts the instructions executed before this one.
+	Cycle       uint64
+	PC          uint16
+	Instruction uint16
+	// A and D hold the registers after the instruction has executed.
+	A uint16
+	D uint16
+	// Write reports whether the instruction wrote Value to RAM at Address, both of which are zero otherwise.
+	Write   bool
+	Address uint16
+	Value   uint16
+}
+
+func (r Record) String() string {
+	str := fmt.Sprintf("%d %d %016b A=%d D=%d", r.Cycle, r.PC, r.Instruction, r.A, r.D)
+	if r.Write {
+		str += fmt.Sprintf(" RAM[%d]=%d", r.Address, r.Value)
+	}
+	return str
+}
+
+// Tracer receives a Record of every instruction executed by a Simulator.
+type Tracer interface {
+	Trace(Record)
+}
+
+// Tracers combines several tracers into one that passes every Record on to all of them in order.
+type Tracers []Tracer
+
+func (t Tracers) Trace(r Record) {
+	for _, tracer := range t {
+		tracer.Trace(r)
+	}
+}
+
+// TraceFormat names the formats that a TraceWriter writes.
+type TraceFormat string
+
+const (
+	// TextTrace writes every Record on a line of its own as formatted by Record.String.
+	TextTrace TraceFormat = "text"
+	// BinaryTrace writes a header of the magic bytes HTRC, a version byte and the cycle of the first record as a big
+	// endian uint64, followed by records of a flags byte and PC, instruction, A and D as big endian uint16. The cycle of
+	// a record is the one following the previous record unless bit 1 of the flags is set, which it is when the cycle
+	// counter has been moved such as by stepping back or restoring a snapshot, in which case the flags are followed by
+	// the cycle as a big endian uint64. If bit 0 of the flags is set the record ends with the address and value written
+	// to RAM.
+	BinaryTrace TraceFormat = "binary"
+)
+
+const (
+	traceMagic   = "HTRC"
+	traceVersion = 2
+	// traceWrite and traceCycle are the flags of a record in a binary trace.
+	traceWrite = 1 << 0
+	traceCycle = 1 << 1
+)
+
+// TraceWriter is a Tracer that writes every Record to an io.Writer. Writes are buffered, Flush must be called once
+// tracing ends. The first error met while writing stops the tracing and is returned by Flush.
+type TraceWriter struct {
+	w      *bufio.Writer
+	format TraceFormat
+	header bool
+	// next is the cycle that the next record is expected to be of.
+	next uint64
+	err  error
+}
+
+func NewTraceWriter(w io.Writer, format TraceFormat) (*TraceWriter, error) {
+	if format != TextTrace && format != BinaryTrace {
+		return nil, fmt.Errorf("unsupported trace format: %s", format)
+	}
+	return &TraceWriter{w: bufio.NewWriter(w), format: format}, nil
+}
+
+func (t *TraceWriter) Trace(r Record) {
+	if t.err != nil {
+		return
+	}
+	if t.format == TextTrace {
+		_, t.err = fmt.Fprintln(t.w, r)
+		return
+	}
+	if !t.header {
+		t.header = true
+		_, t.err = t.w.WriteString(traceMagic)
+		if t.err == nil {
+			t.err = t.w.WriteByte(traceVersion)
+		}
+		if t.err == nil {
+			t.err = binary.Write(t.w, binary.BigEndian, r.Cycle)
+		}
+		t.next = r.Cycle
+	}
+	var buf [21]byte
+	n := 1
+	if r.Cycle != t.next {
+		buf[0] |= traceCycle
+		binary.BigEndian.PutUint64(buf[n:], r.Cycle)
+		n += 8
+	}
+	binary.BigEndian.PutUint16(buf[n:], r.PC)
+	binary.BigEndian.PutUint16(buf[n+2:], r.Instruction)
+	binary.BigEndian.PutUint16(buf[n+4:], r.A)
+	binary.BigEndian.PutUint16(buf[n+6:], r.D)
+	n += 8
+	if r.Write {
+		buf[0] |= traceWrite
+		binary.BigEndian.PutUint16(buf[n:], r.Address)
+		binary.BigEndian.PutUint16(buf[n+2:], r.Value)
+		n += 4
+	}
+	t.next = r.Cycle + 1
+	if t.err == nil {
+		_, t.err = t.w.Write(buf[:n])
+	}
+}
+
+// Flush writes any buffered records and returns the first error met while tracing.
+func (t *TraceWriter) Flush() error {
+	if t.err != nil {
+		return t.err
+	}
+	return t.w.Flush()
+}
+
+// ReadTrace reads a trace written in the BinaryTrace format, calling fn with every Record in order. Reading stops at
+// the first error returned by fn.
+func ReadTrace(r io.Reader, fn func(Record) error) error {
+	br := bufio.NewReader(r)
+	var header [13]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			// Nothing has been traced.
+			return nil
+		}
+		return fmt.Errorf("reading trace header: %w", err)
+	}
+	if string(header[:4]) != traceMagic {
+		return errors.New("not a binary trace")
+	}
+	if header[4] != traceVersion {
+		return fmt.Errorf("unsupported trace version %d", header[4])
+	}
+	cycle := binary.BigEndian.Uint64(header[5:])
+	for ; ; cycle++ {
+		flags, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if flags&^(traceWrite|traceCycle) != 0 {
+			return fmt.Errorf("unsupported flags %08b in record of cycle %d", flags, cycle)
+		}
+		var buf [20]byte
+		n := 8
+		if flags&traceCycle != 0 {
+			n += 8
+		}
+		if flags&traceWrite != 0 {
+			n += 4
+		}
+		if _, err := io.ReadFull(br, buf[:n]); err != nil {
+			return fmt.Errorf("reading record of cycle %d: %w", cycle, err)
+		}
+		fields := buf[:n]
+		if flags&traceCycle != 0 {
+			cycle = binary.BigEndian.Uint64(fields)
+			fields = fields[8:]
+		}
+		rec := Record{
+			Cycle:       cycle,
+			PC:          binary.BigEndian.Uint16(fields[0:]),
+			Instruction: binary.BigEndian.Uint16(fields[2:]),
+			A:           binary.BigEndian.Uint16(fields[4:]),
+			D:           binary.BigEndian.Uint16(fields[6:]),
+		}
+		if flags&traceWrite != 0 {
+			rec.Write = true
+			rec.Address = binary.BigEndian.Uint16(fields[8:])
+			rec.Value = binary.BigEndian.Uint16(fields[10:])
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
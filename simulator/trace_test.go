@@ -0,0 +1,121 @@
+package simulator
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// recorder keeps every Record traced.
+type recorder []Record
+
+func (r *recorder) Trace(rec Record) {
+	*r = append(*r, rec)
+}
+
+func TestTraceWriter(t *testing.T) {
+	var records recorder
+	var text, binary bytes.Buffer
+	textWriter, err := NewTraceWriter(&text, TextTrace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binaryWriter, err := NewTraceWriter(&binary, BinaryTrace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(Parameters{ROM: load(t, sum), Tracer: Tracers{&records, textWriter, binaryWriter}})
+	n := s.RunCycles(1000)
+	if err := textWriter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := binaryWriter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != n {
+		t.Fatalf("expected %d records but got %d", n, len(records))
+	}
+	lines := strings.Split(text.String(), "\n")
+	expected := []string{
+		"0 0 0000000000000000 A=0 D=0",
+		"1 1 1110101010001000 A=0 D=0 RAM[0]=0",
+		"2 2 0000000000001010 A=10 D=0",
+		"3 3 1110110000010000 A=10 D=10",
+		"4 4 0000000000000001 A=1 D=10",
+		"5 5 1110001100001000 A=1 D=10 RAM[1]=10",
+	}
+	if !reflect.DeepEqual(lines[:len(expected)], expected) {
+		t.Errorf("expected trace to begin with %q but got %q", expected, lines[:len(expected)])
+	}
+	if len(lines) != n+1 {
+		t.Errorf("expected %d lines but got %d", n+1, len(lines))
+	}
+	read := make([]Record, 0)
+	if err := ReadTrace(&binary, func(r Record) error {
+		read = append(read, r)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, []Record(records)) {
+		t.Errorf("expected the binary trace to read back the records traced")
+	}
+}
+
+func TestTraceWriter_history(t *testing.T) {
+	var records recorder
+	var binary bytes.Buffer
+	binaryWriter, err := NewTraceWriter(&binary, BinaryTrace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(Parameters{ROM: load(t, sum), Tracer: Tracers{&records, binaryWriter}, History: 100})
+	s.RunCycles(20)
+	for range 5 {
+		if err := s.StepBack(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.RunCycles(10)
+	if err := binaryWriter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if records[20].Cycle != 15 {
+		t.Fatalf("expected the cycle to repeat after stepping back but got %d", records[20].Cycle)
+	}
+	read := make([]Record, 0)
+	if err := ReadTrace(&binary, func(r Record) error {
+		read = append(read, r)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, []Record(records)) {
+		t.Errorf("expected the binary trace to read back the records traced")
+	}
+}
+
+func TestReadTrace_errors(t *testing.T) {
+	tests := []struct {
+		trace    string
+		expected string
+	}{
+		{trace: "HACKTRACE", expected: "reading trace header: unexpected EOF"},
+		{trace: "GIF89a\x00\x00\x00\x00\x00\x00\x00", expected: "not a binary trace"},
+		{trace: "HTRC\x01\x00\x00\x00\x00\x00\x00\x00\x00", expected: "unsupported trace version 1"},
+		{trace: "HTRC\x02\x00\x00\x00\x00\x00\x00\x00\x07\x01\x00\x00", expected: "reading record of cycle 7: unexpected EOF"},
+		{trace: "HTRC\x02\x00\x00\x00\x00\x00\x00\x00\x07\x04", expected: "unsupported flags 00000100 in record of cycle 7"},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			err := ReadTrace(strings.NewReader(test.trace), func(Record) error { return nil })
+			if err == nil || err.Error() != test.expected {
+				t.Errorf("expected error %q but got %v", test.expected, err)
+			}
+		})
+	}
+	if _, err := NewTraceWriter(&bytes.Buffer{}, "json"); err == nil {
+		t.Error("expected an unsupported format to be rejected")
+	}
+}
@@ -131,6 +131,14 @@ func (j JGT) Get() string {
 	return fmt.Sprintf("%s;JGT", j.Instruction.Get())
 }
 
+type JNE struct {
+	Instruction AssemblyInstruction
+}
+
+func (j JNE) Get() string {
+	return fmt.Sprintf("%s;JNE", j.Instruction.Get())
+}
+
 type Assign struct {
 	Source  AssemblyInstruction
 	Targets Targets
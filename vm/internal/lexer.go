@@ -43,7 +43,9 @@ const (
 	IfGoto
 )
 
-func NewLexer(r io.Reader) (*lexer.Lexer[Variant], error) {
+// NewLexer reads all of r and returns a Lexer loaded with its content. The name of the file is attached to the Position
+// of every token produced by the Lexer.
+func NewLexer(file string, r io.Reader) (*lexer.Lexer[Variant], error) {
 	src, err := io.ReadAll(r)
 	if err != nil {
 		return nil, err
@@ -94,7 +96,7 @@ func NewLexer(r io.Reader) (*lexer.Lexer[Variant], error) {
 			lexer.Equals[Variant]('$'),
 		)),
 	)
-	l.Load(string(src))
+	l.LoadFile(file, string(src))
 	return l, nil
 }
 
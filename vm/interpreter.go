@@ -0,0 +1,446 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/crookdc/nand2tetris/lexer"
+	"github.com/crookdc/nand2tetris/simulator"
+	"time"
+)
+
+const (
+	stackBegin  = 256
+	staticBegin = 16
+	staticEnd   = 255
+)
+
+// ErrHalted is returned when stepping an Interpreter whose program has finished.
+var ErrHalted = errors.New("program has halted")
+
+// Frame is an active function call on the call stack of an Interpreter.
+type Frame struct {
+	// Function is the name of the called function.
+	Function string
+	// Call is the position of the call command that created the frame, it is the zero value for the entry function.
+	Call lexer.Position
+	// Return is the index of the instruction that execution resumes at once the function returns.
+	Return int
+}
+
+type InterpreterParameters struct {
+	Screen   simulator.Screen
+	Keyboard simulator.Keyboard
+	Program  Program
+}
+
+// NewInterpreter prepares Program for execution. The program is entered through Sys.init with SP set to 256, just like
+// the bootstrap code of the translator, when it defines such a function and from its first instruction otherwise.
+func NewInterpreter(params InterpreterParameters) (*Interpreter, error) {
+	in := Interpreter{
+		screen:      params.Screen,
+		keyboard:    params.Keyboard,
+		program:     params.Program,
+		functions:   make(map[string]int),
+		labels:      make(map[string]int),
+		statics:     make(map[string]uint16),
+		breakpoints: make(map[int]bool),
+		frames:      make([]Frame, 0),
+		scopes:      make([]string, len(params.Program.Instructions)),
+	}
+	function := ""
+	for i, ins := range in.program.Instructions {
+		switch ins.Opcode {
+		case OpFunction:
+			if _, ok := in.functions[ins.Name]; ok {
+				return nil, lexer.Errorf(ins.Position, "function %s is already defined", ins.Name)
+			}
+			in.functions[ins.Name] = i
+			function = ins.Name
+		case OpLabel:
+			in.labels[scoped(function, ins.Name)] = i
+		}
+		in.scopes[i] = function
+		if ins.Opcode == OpPush || ins.Opcode == OpPop {
+			if ins.Segment != "static" {
+				continue
+			}
+			if _, err := in.static(in.program.Files[i], ins.Index); err != nil {
+				return nil, lexer.Errorf(ins.Position, "%w", err)
+			}
+		}
+	}
+	in.ram[0] = stackBegin
+	if _, ok := in.functions["Sys.init"]; ok {
+		if err := in.call("Sys.init", 0, lexer.Position{}, len(in.program.Instructions)); err != nil {
+			return nil, err
+		}
+	}
+	return &in, nil
+}
+
+// Interpreter executes VM programs directly against a model of the Hack memory map. The stack and the segments of the
+// program live in RAM exactly where the translated program would keep them and the screen and keyboard are memory
+// mapped like on simulator.Simulator, which makes the interpreter a reference for the behaviour of translated code.
+type Interpreter struct {
+	screen      simulator.Screen
+	keyboard    simulator.Keyboard
+	program     Program
+	functions   map[string]int
+	labels      map[string]int
+	statics     map[string]uint16
+	breakpoints map[int]bool
+	ram         [32768]uint16
+	pc          int
+	frames      []Frame
+	// scopes holds the name of the function that each instruction is declared in, which is the scope of its labels.
+	scopes []string
+}
+
+// Peek returns the word stored at addr in RAM.
+func (in *Interpreter) Peek(addr uint16) uint16 {
+	return in.ram[addr%uint16(len(in.ram))]
+}
+
+// Poke stores value at addr in RAM.
+func (in *Interpreter) Poke(addr uint16, value uint16) {
+	in.ram[addr%uint16(len(in.ram))] = value
+}
+
+// Current returns the instruction that executes on the next step. The second return value is false once the program
+// has halted.
+func (in *Interpreter) Current() (Instruction, bool) {
+	if in.Halted() {
+		return Instruction{}, false
+	}
+	return in.program.Instructions[in.pc], true
+}
+
+// Halted reports whether the program has run to completion, which is when execution has moved past the last
+// instruction, the entry function has returned or the program is stuck in an empty loop such as the one of Sys.halt.
+func (in *Interpreter) Halted() bool {
+	if in.pc < 0 || in.pc >= len(in.program.Instructions) {
+		return true
+	}
+	ins := in.program.Instructions[in.pc]
+	if ins.Opcode != OpGoto {
+		return false
+	}
+	target, ok := in.labels[scoped(in.scopes[in.pc], ins.Name)]
+	return ok && target == in.pc-1
+}
+
+// CallStack returns the active function calls, starting with the outermost one.
+func (in *Interpreter) CallStack() []Frame {
+	frames := make([]Frame, len(in.frames))
+	copy(frames, in.frames)
+	return frames
+}
+
+// SetBreakpoint sets a breakpoint on the first instruction at or after line in file, where file is the name of a
+// source as passed to Parse.
+func (in *Interpreter) SetBreakpoint(file string, line int) error {
+	for i, ins := range in.program.Instructions {
+		if ins.Position.File == file && ins.Position.Line >= line {
+			in.breakpoints[i] = true
+			return nil
+		}
+	}
+	return fmt.Errorf("no instruction at or after %s:%d", file, line)
+}
+
+// SetFunctionBreakpoint sets a breakpoint on the first instruction of the function called name.
+func (in *Interpreter) SetFunctionBreakpoint(name string) error {
+	i, ok := in.functions[name]
+	if !ok {
+		return fmt.Errorf("undefined function %s", name)
+	}
+	in.breakpoints[i] = true
+	return nil
+}
+
+func (in *Interpreter) ClearBreakpoints() {
+	in.breakpoints = make(map[int]bool)
+}
+
+// Continue executes instructions until a breakpoint is reached or the program halts, refreshing the screen and polling
+// the keyboard 33 times per second. At least one instruction is executed so that calling Continue while stopped at a
+// breakpoint moves past it. It reports whether execution stopped at a breakpoint.
+func (in *Interpreter) Continue() (bool, error) {
+	if err := in.refresh(); err != nil {
+		return false, err
+	}
+	external := time.NewTicker(time.Second / 33)
+	defer external.Stop()
+	for {
+		select {
+		case <-external.C:
+			if err := in.refresh(); err != nil {
+				return false, err
+			}
+		default:
+			if in.Halted() {
+				return false, in.refresh()
+			}
+			if err := in.Step(); err != nil {
+				return false, err
+			}
+			if in.breakpoints[in.pc] && !in.Halted() {
+				return true, in.refresh()
+			}
+		}
+	}
+}
+
+func (in *Interpreter) refresh() error {
+	if in.keyboard != nil {
+		in.ram[simulator.KeyboardMemoryMapAddress] = in.keyboard.Poll()
+	}
+	if in.screen != nil {
+		return simulator.Draw(in.screen, in.ram[:])
+	}
+	return nil
+}
+
+// Step executes a single instruction. Errors are reported at the position of the failing instruction.
+func (in *Interpreter) Step() error {
+	if in.Halted() {
+		return ErrHalted
+	}
+	ins := in.program.Instructions[in.pc]
+	if err := in.execute(in.pc, ins); err != nil {
+		return lexer.Errorf(ins.Position, "%w", err)
+	}
+	return nil
+}
+
+func (in *Interpreter) execute(pc int, ins Instruction) error {
+	in.pc++
+	switch ins.Opcode {
+	case OpPush:
+		addr, err := in.address(pc, ins)
+		if err != nil {
+			return err
+		}
+		if ins.Segment == "constant" {
+			return in.push(uint16(ins.Index))
+		}
+		return in.push(in.ram[addr])
+	case OpPop:
+		addr, err := in.address(pc, ins)
+		if err != nil {
+			return err
+		}
+		v, err := in.pop()
+		if err != nil {
+			return err
+		}
+		in.ram[addr] = v
+	case OpAdd, OpSub, OpAnd, OpOr, OpEq, OpGt, OpLt:
+		y, err := in.pop()
+		if err != nil {
+			return err
+		}
+		x, err := in.pop()
+		if err != nil {
+			return err
+		}
+		return in.push(binary(ins.Opcode, x, y))
+	case OpNeg, OpNot:
+		x, err := in.pop()
+		if err != nil {
+			return err
+		}
+		if ins.Opcode == OpNeg {
+			return in.push(-x)
+		}
+		return in.push(^x)
+	case OpLabel:
+	case OpGoto:
+		return in.jump(in.scopes[pc], ins.Name)
+	case OpIfGoto:
+		cond, err := in.pop()
+		if err != nil {
+			return err
+		}
+		if cond != 0 {
+			return in.jump(in.scopes[pc], ins.Name)
+		}
+	case OpFunction:
+		for range ins.Index {
+			if err := in.push(0); err != nil {
+				return err
+			}
+		}
+	case OpCall:
+		return in.call(ins.Name, ins.Index, ins.Position, in.pc)
+	case OpReturn:
+		return in.ret()
+	default:
+		return fmt.Errorf("unsupported instruction %s", ins.Literal())
+	}
+	return nil
+}
+
+func binary(op Opcode, x, y uint16) uint16 {
+	boolean := func(b bool) uint16 {
+		if b {
+			return 0xFFFF
+		}
+		return 0
+	}
+	switch op {
+	case OpAdd:
+		return x + y
+	case OpSub:
+		return x - y
+	case OpAnd:
+		return x & y
+	case OpOr:
+		return x | y
+	case OpEq:
+		return boolean(x == y)
+	case OpGt:
+		return boolean(int16(x) > int16(y))
+	default:
+		return boolean(int16(x) < int16(y))
+	}
+}
+
+// address resolves the RAM address that a push or pop instruction refers to. Constants have no address and resolve to
+// zero.
+func (in *Interpreter) address(pc int, ins Instruction) (uint16, error) {
+	var addr uint16
+	switch ins.Segment {
+	case "constant":
+		return 0, nil
+	case "local":
+		addr = in.ram[1] + uint16(ins.Index)
+	case "argument":
+		addr = in.ram[2] + uint16(ins.Index)
+	case "this":
+		addr = in.ram[3] + uint16(ins.Index)
+	case "that":
+		addr = in.ram[4] + uint16(ins.Index)
+	case "pointer":
+		if ins.Index < 0 || ins.Index > 1 {
+			return 0, fmt.Errorf("invalid pointer index %d", ins.Index)
+		}
+		addr = 3 + uint16(ins.Index)
+	case "temp":
+		if ins.Index < 0 || ins.Index > 7 {
+			return 0, fmt.Errorf("invalid temp index %d", ins.Index)
+		}
+		addr = 5 + uint16(ins.Index)
+	case "static":
+		return in.static(in.program.Files[pc], ins.Index)
+	default:
+		return 0, fmt.Errorf("unsupported segment %s", ins.Segment)
+	}
+	if int(addr) >= len(in.ram) {
+		return 0, fmt.Errorf("address %d is out of range", addr)
+	}
+	return addr, nil
+}
+
+// static allocates the static variables of each file consecutively from address 16 in the order that they are first
+// referenced, which is the order that the assembler allocates the variables of translated statics in.
+func (in *Interpreter) static(file string, index int) (uint16, error) {
+	key := fmt.Sprintf("%s.%d", file, index)
+	if addr, ok := in.statics[key]; ok {
+		return addr, nil
+	}
+	addr := staticBegin + uint16(len(in.statics))
+	if addr > staticEnd {
+		return 0, fmt.Errorf("static variable %s does not fit in the static segment", key)
+	}
+	in.statics[key] = addr
+	return addr, nil
+}
+
+func (in *Interpreter) jump(function string, label string) error {
+	target, ok := in.labels[scoped(function, label)]
+	if !ok {
+		return fmt.Errorf("undefined label %s", label)
+	}
+	in.pc = target
+	return nil
+}
+
+func (in *Interpreter) push(v uint16) error {
+	sp := in.ram[0]
+	if int(sp) >= int(simulator.ScreenMemoryMapBegin) {
+		return errors.New("stack overflow")
+	}
+	in.ram[sp] = v
+	in.ram[0]++
+	return nil
+}
+
+func (in *Interpreter) pop() (uint16, error) {
+	if in.ram[0] <= stackBegin {
+		return 0, errors.New("stack underflow")
+	}
+	if int(in.ram[0]) > len(in.ram) {
+		return 0, fmt.Errorf("stack pointer %d is out of range", in.ram[0])
+	}
+	in.ram[0]--
+	return in.ram[in.ram[0]], nil
+}
+
+// call saves the frame of the caller on the stack following the standard calling convention and transfers control to
+// fn. The return address saved on the stack is the index of the instruction to return to.
+func (in *Interpreter) call(fn string, args int, pos lexer.Position, ret int) error {
+	target, ok := in.functions[fn]
+	if !ok {
+		return fmt.Errorf("undefined function %s", fn)
+	}
+	for _, v := range []uint16{uint16(ret), in.ram[1], in.ram[2], in.ram[3], in.ram[4]} {
+		if err := in.push(v); err != nil {
+			return err
+		}
+	}
+	in.ram[2] = in.ram[0] - 5 - uint16(args)
+	in.ram[1] = in.ram[0]
+	in.frames = append(in.frames, Frame{
+		Function: fn,
+		Call:     pos,
+		Return:   ret,
+	})
+	in.pc = target
+	return nil
+}
+
+func (in *Interpreter) ret() error {
+	if len(in.frames) == 0 {
+		// Returning without a call halts the program
+		in.pc = len(in.program.Instructions)
+		return nil
+	}
+	// The segment pointers may have been overwritten by the program, so they are checked before use.
+	frame := in.ram[1]
+	if frame < 5 || int(frame) > len(in.ram) {
+		return fmt.Errorf("frame pointer %d is out of range", frame)
+	}
+	if int(in.ram[2]) >= len(in.ram) {
+		return fmt.Errorf("argument pointer %d is out of range", in.ram[2])
+	}
+	ret := in.ram[frame-5]
+	v, err := in.pop()
+	if err != nil {
+		return err
+	}
+	in.ram[in.ram[2]] = v
+	in.ram[0] = in.ram[2] + 1
+	in.ram[4] = in.ram[frame-1]
+	in.ram[3] = in.ram[frame-2]
+	in.ram[2] = in.ram[frame-3]
+	in.ram[1] = in.ram[frame-4]
+	in.frames = in.frames[:len(in.frames)-1]
+	in.pc = int(ret)
+	return nil
+}
+
+// scoped qualifies label with the function it is declared in, labels being scoped to functions.
+func scoped(function string, label string) string {
+	return fmt.Sprintf("%s$%s", function, label)
+}
@@ -0,0 +1,205 @@
+package vm
+
+import (
+	"errors"
+	"github.com/crookdc/nand2tetris/simulator"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type keyboard uint16
+
+func (k keyboard) Poll() uint16 {
+	return uint16(k)
+}
+
+type screen struct {
+	presented int
+}
+
+func (s *screen) Clear() error {
+	return nil
+}
+
+func (s *screen) Fill(simulator.Color, ...simulator.Point) error {
+	return nil
+}
+
+func (s *screen) Present() {
+	s.presented++
+}
+
+func interpreter(t *testing.T, params InterpreterParameters, sources ...Source) *Interpreter {
+	program, err := Parse(sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params.Program = program
+	in, err := NewInterpreter(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return in
+}
+
+func TestInterpreter_Step(t *testing.T) {
+	in := interpreter(
+		t,
+		InterpreterParameters{},
+		Source{Name: "Main.vm", Reader: strings.NewReader("push constant 7\npush constant 8\nadd\npush constant 20\nlt\npop temp 2")},
+	)
+	for range 6 {
+		if err := in.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !in.Halted() {
+		t.Error("expected program to have halted")
+	}
+	if err := in.Step(); !errors.Is(err, ErrHalted) {
+		t.Errorf("expected %v but got %v", ErrHalted, err)
+	}
+	if v := in.Peek(7); v != 0xFFFF {
+		t.Errorf("expected temp 2 to be true but got %d", v)
+	}
+	if sp := in.Peek(0); sp != 256 {
+		t.Errorf("expected an empty stack but SP is %d", sp)
+	}
+}
+
+func TestInterpreter_Continue(t *testing.T) {
+	sys := `function Sys.init 0
+push constant 10
+call Main.fibonacci 1
+pop static 0
+push constant 24576
+pop pointer 1
+push that 0
+pop static 1
+label HALT
+goto HALT`
+	main := `function Main.fibonacci 0
+push argument 0
+push constant 2
+lt
+if-goto BASE
+push argument 0
+push constant 1
+sub
+call Main.fibonacci 1
+push argument 0
+push constant 2
+sub
+call Main.fibonacci 1
+add
+return
+label BASE
+push static 0
+push constant 1
+add
+pop static 0
+push argument 0
+return`
+	s := &screen{}
+	in := interpreter(
+		t,
+		InterpreterParameters{Screen: s, Keyboard: keyboard('k')},
+		Source{Name: "Sys.vm", Reader: strings.NewReader(sys)},
+		Source{Name: "Main.vm", Reader: strings.NewReader(main)},
+	)
+	if err := in.SetBreakpoint("Main.vm", 16); err != nil {
+		t.Fatal(err)
+	}
+	stopped, err := in.Continue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stopped {
+		t.Fatal("expected to stop at the breakpoint")
+	}
+	ins, _ := in.Current()
+	if ins.Literal() != "label BASE" || ins.Position.Line != 16 {
+		t.Errorf("expected to stop at label BASE on line 16 but stopped at %s on line %d", ins.Literal(), ins.Position.Line)
+	}
+	functions := make([]string, 0)
+	for _, frame := range in.CallStack() {
+		functions = append(functions, frame.Function)
+	}
+	expected := []string{"Sys.init"}
+	for range 10 {
+		expected = append(expected, "Main.fibonacci")
+	}
+	if !reflect.DeepEqual(functions, expected) {
+		t.Errorf("expected call stack %v but got %v", expected, functions)
+	}
+	in.ClearBreakpoints()
+	stopped, err = in.Continue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stopped || !in.Halted() {
+		t.Fatal("expected program to run until it halts")
+	}
+	// Statics are allocated in the order they appear in the program, starting with Sys.0 and Sys.1 of the first source.
+	if v := in.Peek(16); v != 55 {
+		t.Errorf("expected Sys.0 to be 55 but got %d", v)
+	}
+	if v := in.Peek(17); v != 'k' {
+		t.Errorf("expected Sys.1 to hold the polled key but got %d", v)
+	}
+	// Main.0 counts the calls that reached the base case.
+	if v := in.Peek(18); v != 89 {
+		t.Errorf("expected Main.0 to be 89 but got %d", v)
+	}
+	if len(in.CallStack()) != 1 {
+		t.Errorf("expected only Sys.init to remain on the call stack but got %v", in.CallStack())
+	}
+	if s.presented == 0 {
+		t.Error("expected the screen to have been drawn")
+	}
+}
+
+func TestInterpreter_errors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{
+			src:      "push constant 1\ncall Main.missing 1",
+			expected: "Main.vm:2:1: undefined function Main.missing",
+		},
+		{
+			src:      "add",
+			expected: "Main.vm:1:1: stack underflow",
+		},
+		{
+			src:      "function Main.main 0\ngoto NOWHERE",
+			expected: "Main.vm:2:1: undefined label NOWHERE",
+		},
+		{
+			src:      "push constant 0\npop pointer 1\npush constant 20000\npush constant 20000\nadd\npop that 0\nadd",
+			expected: "Main.vm:7:1: stack pointer 40000 is out of range",
+		},
+		{
+			src:      "function Sys.init 0\npush constant 1\npop pointer 0\npush constant 3\npop this 0\npush constant 0\nreturn",
+			expected: "Main.vm:7:1: frame pointer 3 is out of range",
+		},
+		{
+			src:      "function Sys.init 0\npush constant 2\npop pointer 0\npush constant 32767\npush constant 2\nadd\npop this 0\npush constant 0\nreturn",
+			expected: "Main.vm:9:1: argument pointer 32769 is out of range",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			in := interpreter(t, InterpreterParameters{}, Source{Name: "Main.vm", Reader: strings.NewReader(test.src)})
+			_, err := in.Continue()
+			if err == nil {
+				t.Fatal("expected an error but got nil")
+			}
+			if err.Error() != test.expected {
+				t.Errorf("expected %q but got %q", test.expected, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package vm
+
+import (
+	"github.com/crookdc/nand2tetris/asm"
+	"slices"
+	"strings"
+)
+
+// rewrite attempts to replace the instructions at the beginning of asm. It returns the replacement and the number of
+// instructions replaced, or false if it does not apply.
+type rewrite func(asm []string) ([]string, int, bool)
+
+// rewrites are the peephole optimizations applied by Optimize. Each rewrite relies on two properties of translated
+// code: no command reads D or A before assigning them, and memory above the top of the stack is never read before it is
+// written. Jump targets are always labels which the patterns never span, so every window is entered from the top.
+var rewrites = []rewrite{
+	// A push immediately followed by a pop into D leaves the value in D. The slot is still written since some pops read
+	// the popped value back from memory.
+	literal(
+		[]string{"@SP", "A=M", "M=D", "@SP", "M=M+1", "@SP", "AM=M-1", "D=M"},
+		[]string{"@SP", "A=M", "M=D"},
+	),
+	// A value written above the top of the stack is dead once the stack shrinks below it.
+	literal(
+		[]string{"@SP", "A=M", "M=D", "@SP", "AM=M-1"},
+		[]string{"@SP", "AM=M-1"},
+	),
+	literal(
+		[]string{"@SP", "A=M", "M=D", "@SP", "A=M-1"},
+		[]string{"@SP", "A=M-1"},
+	),
+	// A still holds the address of SP after incrementing it.
+	literal(
+		[]string{"@SP", "M=M+1", "@SP"},
+		[]string{"@SP", "M=M+1"},
+	),
+	// The address of the next element to pop is already in A after a pop.
+	literal(
+		[]string{"@SP", "AM=M-1", "D=M", "@SP", "A=M-1"},
+		[]string{"@SP", "AM=M-1", "D=M", "A=A-1"},
+	),
+	inPlace,
+	// Adding or subtracting a constant one needs neither D nor the constant.
+	literal(
+		[]string{"@1", "D=A", "@SP", "A=M-1", "M=D+M"},
+		[]string{"@SP", "A=M-1", "M=M+1"},
+	),
+	literal(
+		[]string{"@1", "D=A", "@SP", "A=M-1", "M=M-D"},
+		[]string{"@SP", "A=M-1", "M=M-1"},
+	),
+	// Accessing the first element of a segment needs no offset.
+	literal(
+		[]string{"@0", "A=D+A"},
+		[]string{"A=D"},
+	),
+	overwritten([]string{"@0", "D=D+A"}, nil),
+}
+
+// constants loads the constants zero and one directly into D rather than through A. They are applied once the other
+// rewrites are exhausted since they would otherwise hide the patterns that eliminate the constants altogether.
+var constants = []rewrite{
+	overwritten([]string{"@0", "D=A"}, []string{"D=0"}),
+	overwritten([]string{"@1", "D=A"}, []string{"D=1"}),
+}
+
+// literal replaces every occurrence of pattern with replacement.
+func literal(pattern []string, replacement []string) rewrite {
+	return func(asm []string) ([]string, int, bool) {
+		if len(asm) < len(pattern) || !slices.Equal(asm[:len(pattern)], pattern) {
+			return nil, 0, false
+		}
+		return replacement, len(pattern), true
+	}
+}
+
+// inPlace rewrites an operation that pops the top of the stack into D, computes a new value from it and pushes the
+// value back into one that computes the value directly into the top of the stack.
+func inPlace(asm []string) ([]string, int, bool) {
+	if len(asm) < 8 || !slices.Equal(asm[:2], []string{"@SP", "AM=M-1"}) {
+		return nil, 0, false
+	}
+	if !slices.Equal(asm[3:8], []string{"@SP", "A=M", "M=D", "@SP", "M=M+1"}) {
+		return nil, 0, false
+	}
+	computation, ok := strings.CutPrefix(asm[2], "D=")
+	if !ok || strings.Contains(computation, "A") {
+		return nil, 0, false
+	}
+	return []string{"@SP", "A=M-1", "M=" + computation}, 8, true
+}
+
+// overwritten replaces pattern with replacement where A is assigned right after pattern, making any difference in the
+// value that they leave in A irrelevant.
+func overwritten(pattern []string, replacement []string) rewrite {
+	return func(asm []string) ([]string, int, bool) {
+		if len(asm) <= len(pattern) || !slices.Equal(asm[:len(pattern)], pattern) {
+			return nil, 0, false
+		}
+		if !strings.HasPrefix(asm[len(pattern)], "@") {
+			return nil, 0, false
+		}
+		return replacement, len(pattern), true
+	}
+}
+
+// Optimize applies peephole optimizations to the assembly produced by the translator until no more apply. The result
+// behaves identically to asm while consisting of fewer instructions.
+func Optimize(asm []string) []string {
+	asm, _ = optimizeOrigins(asm, nil)
+	return asm
+}
+
+// optimizeOrigins works like Optimize while keeping origins, which holds the origin of every instruction in code, in
+// step with the instructions. A replacement takes the origin of the first instruction it replaces. The origins may be
+// nil, in which case nil is returned in their place.
+func optimizeOrigins(code []string, origins []asm.Origin) ([]string, []asm.Origin) {
+	for changed := true; changed; {
+		code, origins, changed = optimize(code, origins, rewrites)
+	}
+	code, origins, _ = optimize(code, origins, constants)
+	return code, origins
+}
+
+func optimize(code []string, origins []asm.Origin, rewrites []rewrite) ([]string, []asm.Origin, bool) {
+	optimized := make([]string, 0, len(code))
+	var moved []asm.Origin
+	if origins != nil {
+		moved = make([]asm.Origin, 0, len(origins))
+	}
+	changed := false
+	for i := 0; i < len(code); {
+		applied := false
+		for _, rw := range rewrites {
+			replacement, n, ok := rw(code[i:])
+			if ok {
+				optimized = append(optimized, replacement...)
+				if origins != nil {
+					for range replacement {
+						moved = append(moved, origins[i])
+					}
+				}
+				i += n
+				applied, changed = true, true
+				break
+			}
+		}
+		if !applied {
+			optimized = append(optimized, code[i])
+			if origins != nil {
+				moved = append(moved, origins[i])
+			}
+			i++
+		}
+	}
+	return optimized, moved, changed
+}
+
+// Count returns the number of machine instructions in asm, not counting labels.
+func Count(asm []string) int {
+	n := 0
+	for _, ins := range asm {
+		if !strings.HasPrefix(ins, "(") {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,131 @@
+package vm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected []string
+	}{
+		{
+			src: "push constant 7\npush constant 8\nadd",
+			expected: []string{
+				"@7",
+				"D=A",
+				"@SP",
+				"A=M",
+				"M=D",
+				"@SP",
+				"M=M+1",
+				"@8",
+				"D=A",
+				"@SP",
+				"A=M-1",
+				"M=D+M",
+			},
+		},
+		{
+			src: "push local 0\npush constant 1\nadd",
+			expected: []string{
+				"@LCL",
+				"D=M",
+				"A=D",
+				"D=M",
+				"@SP",
+				"A=M",
+				"M=D",
+				"@SP",
+				"M=M+1",
+				"A=M-1",
+				"M=M+1",
+			},
+		},
+		{
+			src: "neg\nnot",
+			expected: []string{
+				"@SP",
+				"A=M-1",
+				"M=-M",
+				"@SP",
+				"A=M-1",
+				"M=!M",
+			},
+		},
+		{
+			src: "push constant 0\npop temp 1",
+			expected: []string{
+				"D=0",
+				"@SP",
+				"A=M",
+				"M=D",
+				"@6",
+				"M=D",
+			},
+		},
+		{
+			src: "push argument 1\nlabel LOOP\nif-goto LOOP",
+			expected: []string{
+				"@ARG",
+				"D=M",
+				"@1",
+				"A=D+A",
+				"D=M",
+				"@SP",
+				"A=M",
+				"M=D",
+				"@SP",
+				"M=M+1",
+				"(LOOP)",
+				"@SP",
+				"AM=M-1",
+				"D=M",
+				"@LOOP",
+				"D;JNE",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			asm, err := Translate("Main", strings.NewReader(test.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := Optimize(asm)
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("expected\n%s\nbut got\n%s", strings.Join(test.expected, "\n"), strings.Join(actual, "\n"))
+			}
+		})
+	}
+}
+
+func TestTranslateProgram_optimize(t *testing.T) {
+	reported := make(map[string][2]int)
+	opts := Options{
+		Optimize: true,
+		Optimized: func(source string, before, after int) {
+			reported[source] = [2]int{before, after}
+		},
+	}
+	sources := []Source{
+		{Name: "Main.vm", Reader: strings.NewReader("push constant 1\npush constant 2\nadd\nlabel END\ngoto END")},
+		{Name: "Math.vm", Reader: strings.NewReader("goto END")},
+	}
+	actual, err := TranslateProgram(sources, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][2]int{
+		"Main.vm": {27, 13},
+		"Math.vm": {2, 2},
+	}
+	if !reflect.DeepEqual(reported, expected) {
+		t.Errorf("expected reported counts %v but got %v", expected, reported)
+	}
+	if Count(actual) != 15 {
+		t.Errorf("expected 15 instructions but got %d", Count(actual))
+	}
+}
@@ -0,0 +1,209 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/crookdc/nand2tetris/diagnostic"
+	"github.com/crookdc/nand2tetris/lexer"
+	"github.com/crookdc/nand2tetris/vm/internal"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Opcode identifies the command of an Instruction.
+type Opcode int
+
+const (
+	OpPush Opcode = iota
+	OpPop
+	OpAdd
+	OpSub
+	OpNeg
+	OpEq
+	OpGt
+	OpLt
+	OpAnd
+	OpOr
+	OpNot
+	OpLabel
+	OpGoto
+	OpIfGoto
+	OpFunction
+	OpCall
+	OpReturn
+)
+
+var opcodes = map[internal.Variant]Opcode{
+	internal.Push:     OpPush,
+	internal.Pop:      OpPop,
+	internal.Add:      OpAdd,
+	internal.Sub:      OpSub,
+	internal.Neg:      OpNeg,
+	internal.Eq:       OpEq,
+	internal.Gt:       OpGt,
+	internal.Lt:       OpLt,
+	internal.And:      OpAnd,
+	internal.Or:       OpOr,
+	internal.Not:      OpNot,
+	internal.Label:    OpLabel,
+	internal.Goto:     OpGoto,
+	internal.IfGoto:   OpIfGoto,
+	internal.Function: OpFunction,
+	internal.Call:     OpCall,
+	internal.Return:   OpReturn,
+}
+
+var arithmetic = map[Opcode]string{
+	OpAdd: "add",
+	OpSub: "sub",
+	OpNeg: "neg",
+	OpEq:  "eq",
+	OpGt:  "gt",
+	OpLt:  "lt",
+	OpAnd: "and",
+	OpOr:  "or",
+	OpNot: "not",
+}
+
+var segments = map[internal.Variant]string{
+	internal.Constant: "constant",
+	internal.Local:    "local",
+	internal.Argument: "argument",
+	internal.This:     "this",
+	internal.That:     "that",
+	internal.Pointer:  "pointer",
+	internal.Temp:     "temp",
+	internal.Static:   "static",
+}
+
+// Instruction is a single parsed VM command. Segment and Index are set for push and pop, Name is the label of label,
+// goto and if-goto and the function of function and call, while Index is the number of locals of function and the
+// number of arguments of call.
+type Instruction struct {
+	Opcode   Opcode
+	Segment  string
+	Index    int
+	Name     string
+	Position lexer.Position
+}
+
+// Literal returns the instruction as it is written in the VM language.
+func (i Instruction) Literal() string {
+	switch i.Opcode {
+	case OpPush:
+		return fmt.Sprintf("push %s %d", i.Segment, i.Index)
+	case OpPop:
+		return fmt.Sprintf("pop %s %d", i.Segment, i.Index)
+	case OpLabel:
+		return fmt.Sprintf("label %s", i.Name)
+	case OpGoto:
+		return fmt.Sprintf("goto %s", i.Name)
+	case OpIfGoto:
+		return fmt.Sprintf("if-goto %s", i.Name)
+	case OpFunction:
+		return fmt.Sprintf("function %s %d", i.Name, i.Index)
+	case OpCall:
+		return fmt.Sprintf("call %s %d", i.Name, i.Index)
+	case OpReturn:
+		return "return"
+	default:
+		if m, ok := arithmetic[i.Opcode]; ok {
+			return m
+		}
+		return fmt.Sprintf("Opcode(%d)", int(i.Opcode))
+	}
+}
+
+// Program is the parsed form of a set of VM sources. File holds the name of the source each instruction was parsed
+// from without directory or extension, which qualifies the static variables of the instruction.
+type Program struct {
+	Instructions []Instruction
+	Files        []string
+}
+
+// Parse parses sources into a single Program, reporting every malformed command as part of a diagnostic.List.
+func Parse(sources []Source) (Program, error) {
+	program := Program{
+		Instructions: make([]Instruction, 0),
+		Files:        make([]string, 0),
+	}
+	var diagnostics diagnostic.List
+	for _, src := range sources {
+		lx, err := internal.NewLexer(src.Name, src.Reader)
+		if err != nil {
+			return Program{}, err
+		}
+		name := strings.TrimSuffix(filepath.Base(src.Name), filepath.Ext(src.Name))
+		for ins, err := parse(lx); !errors.Is(err, io.EOF); ins, err = parse(lx) {
+			if err != nil {
+				diagnostics.Add(err)
+				_ = lx.Seek(lexer.Equals[internal.Variant]('\n'))
+				continue
+			}
+			program.Instructions = append(program.Instructions, ins)
+			program.Files = append(program.Files, name)
+		}
+	}
+	if err := diagnostics.Err(); err != nil {
+		return Program{}, err
+	}
+	return program, nil
+}
+
+func parse(lx internal.Lexer) (Instruction, error) {
+	token, err := lx.Next()
+	if err != nil {
+		return Instruction{}, err
+	}
+	op, ok := opcodes[token.Variant]
+	if !ok {
+		return Instruction{}, lexer.TokenErrorf(token, "unexpected token: %s", token.Literal)
+	}
+	ins := Instruction{Opcode: op, Position: token.Position}
+	switch op {
+	case OpPush, OpPop:
+		segment, err := lx.Next()
+		if err != nil {
+			return Instruction{}, lexer.Errorf(lx.Position(), "%w", io.ErrUnexpectedEOF)
+		}
+		name, ok := segments[segment.Variant]
+		if !ok || (op == OpPop && segment.Variant == internal.Constant) {
+			return Instruction{}, lexer.TokenErrorf(segment, "%s segment not supported: %s", token.Literal, segment.Literal)
+		}
+		ins.Segment = name
+		ins.Index, err = integer(lx)
+		if err != nil {
+			return Instruction{}, err
+		}
+		if (segment.Variant == internal.Pointer && ins.Index > 1) || (segment.Variant == internal.Temp && ins.Index > 7) {
+			return Instruction{}, lexer.TokenErrorf(segment, "invalid %s index %d", name, ins.Index)
+		}
+	case OpLabel, OpGoto, OpIfGoto:
+		label, err := lx.Expect(internal.Identifier)
+		if err != nil {
+			return Instruction{}, err
+		}
+		ins.Name = label.Literal
+	case OpFunction, OpCall:
+		fn, err := lx.Expect(internal.Identifier)
+		if err != nil {
+			return Instruction{}, err
+		}
+		ins.Name = fn.Literal
+		ins.Index, err = integer(lx)
+		if err != nil {
+			return Instruction{}, err
+		}
+	}
+	return ins, nil
+}
+
+func integer(lx internal.Lexer) (int, error) {
+	i, err := lx.Expect(internal.Integer)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(i.Literal)
+}
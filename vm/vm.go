@@ -1,36 +1,206 @@
 package vm
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"github.com/crookdc/nand2tetris/asm"
+	"github.com/crookdc/nand2tetris/diagnostic"
+	"github.com/crookdc/nand2tetris/lexer"
 	"github.com/crookdc/nand2tetris/vm/internal"
 	"io"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 )
 
+// Translate converts the VM code read from r into Hack assembly. The file name is used in reported positions and to
+// name the static variables of the file.
 func Translate(file string, r io.Reader) ([]string, error) {
-	lx, err := internal.NewLexer(r)
-	if err != nil {
-		return nil, err
+	return TranslateProgram([]Source{{Name: file, Reader: r}}, Options{})
+}
+
+// Source is a named unit of VM code, usually the contents of a single .vm file.
+type Source struct {
+	Name   string
+	Reader io.Reader
+}
+
+// Options controls how a program is translated.
+type Options struct {
+	// Bootstrap prepends the standard bootstrap code that sets SP to 256 and calls Sys.init.
+	Bootstrap bool
+	// Optimize applies the peephole optimizations of Optimize to the code of every source.
+	Optimize bool
+	// Optimized is called with the number of instructions before and after optimizing each source, if set.
+	Optimized func(source string, before, after int)
+	// Trampolines makes every call and return jump to a single shared routine that saves or restores the frame, rather
+	// than inlining that code at every call and return. This trades a few cycles per call for a much smaller program.
+	Trampolines bool
+	// Complete reports calls to functions that none of the sources define, including the call of the bootstrap code to
+	// Sys.init. Set it when the sources make up the entire program, since the assembler would otherwise quietly turn
+	// the missing functions into variables.
+	Complete bool
+}
+
+// TranslateProgram translates and links several VM sources into a single assembly program. Functions may call
+// functions defined in any of the sources while the static segment of each source is kept separate from the others.
+func TranslateProgram(sources []Source, opts Options) ([]string, error) {
+	program, _, err := TranslateDebug(sources, opts)
+	return program, err
+}
+
+// TranslateDebug works like TranslateProgram but also returns the origin of every line of the program, which is the VM
+// command and function that the line was generated from. See asm.AssembleGenerated for carrying the origins through to
+// ROM addresses.
+func TranslateDebug(sources []Source, opts Options) ([]string, []asm.Origin, error) {
+	vm := VM{trampolines: opts.Trampolines}
+	var diagnostics diagnostic.List
+	program := make([]string, 0)
+	origins := make([]asm.Origin, 0)
+	if opts.Bootstrap {
+		tree, err := vm.Bootstrap().Compile()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, ins := range tree {
+			program = append(program, ins.Get())
+			origins = append(origins, asm.Origin{Function: vm.context, Command: "bootstrap"})
+		}
 	}
-	vm := VM{
-		file: file,
-		lx:   lx,
+	for _, src := range sources {
+		text, err := io.ReadAll(src.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		lx, err := internal.NewLexer(src.Name, bytes.NewReader(text))
+		if err != nil {
+			return nil, nil, err
+		}
+		vm.file = src.Name
+		vm.name = strings.TrimSuffix(filepath.Base(src.Name), filepath.Ext(src.Name))
+		vm.context = ""
+		vm.lx = lx
+		code := make([]string, 0)
+		generated := make([]asm.Origin, 0)
+		for cmd, err := vm.Next(); !errors.Is(err, io.EOF); cmd, err = vm.Next() {
+			if err != nil {
+				// Report the malformed command and carry on from the next line to find any further problems.
+				diagnostics.Add(err)
+				vm.synchronize()
+				continue
+			}
+			tree, err := cmd.Compile()
+			if err != nil {
+				diagnostics.Add(lexer.Errorf(vm.position, "%w", err))
+				continue
+			}
+			origin := asm.Origin{
+				Position: vm.position,
+				Function: vm.context,
+				Command:  strings.Join(strings.Fields(string(text[vm.position.Offset:lx.Position().Offset])), " "),
+			}
+			for _, ins := range tree {
+				code = append(code, ins.Get())
+				generated = append(generated, origin)
+			}
+		}
+		if opts.Optimize {
+			optimized, moved := optimizeOrigins(code, generated)
+			if opts.Optimized != nil {
+				opts.Optimized(src.Name, Count(code), Count(optimized))
+			}
+			code, generated = optimized, moved
+		}
+		program = append(program, code...)
+		origins = append(origins, generated...)
 	}
-	cmds := make(Command, 0)
-	for cmd, err := vm.Next(); err != io.EOF; cmd, err = vm.Next() {
-		cmds = append(cmds, cmd...)
+	if opts.Complete {
+		if opts.Bootstrap && !vm.functions["Sys.init"] {
+			diagnostics.Add(errors.New("the bootstrap code calls Sys.init, which is not defined"))
+		}
+		for _, fn := range vm.calls {
+			if !vm.functions[fn.Literal] {
+				diagnostics.Add(lexer.TokenErrorf(fn, "call to undefined function %s", fn.Literal))
+			}
+		}
 	}
-	tree, err := cmds.Compile()
+	if err := diagnostics.Err(); err != nil {
+		return nil, nil, err
+	}
+	if opts.Trampolines {
+		tree, err := vm.Trampolines().Compile()
+		if err != nil {
+			return nil, nil, err
+		}
+		routines := make([]string, len(tree))
+		for i, ins := range tree {
+			routines[i] = ins.Get()
+		}
+		if opts.Optimize {
+			routines = Optimize(routines)
+		}
+		// The shared routines belong to no function, they are attributed to the command that jumps to them instead.
+		command := "call"
+		for _, ins := range routines {
+			if ins == (Label{Value: ReturnTrampoline}).Get() {
+				command = "return"
+			}
+			program = append(program, ins)
+			origins = append(origins, asm.Origin{Command: command})
+		}
+	}
+	return program, origins, nil
+}
+
+// TranslateDir translates every .vm file in dir into a single assembly program, see TranslateProgram.
+func TranslateDir(dir string, opts Options) ([]string, error) {
+	sources, err := ReadSources(dir)
+	if err != nil {
+		return nil, err
+	}
+	return TranslateProgram(sources, opts)
+}
+
+// ReadSources reads the VM file at path, or every .vm file in it if path is a directory, into Sources named after the
+// files.
+func ReadSources(path string) ([]Source, error) {
+	files := []string{path}
+	info, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
-	asm := make([]string, 0)
-	for _, ins := range tree {
-		asm = append(asm, ins.Get())
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		files = files[:0]
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".vm" {
+				continue
+			}
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
 	}
-	return asm, nil
+	sources := make([]Source, len(files))
+	for i, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		sources[i] = Source{Name: file, Reader: bytes.NewReader(src)}
+	}
+	return sources, nil
 }
 
+var (
+	// CallTrampoline and ReturnTrampoline label the shared routines generated by VM.Trampolines.
+	CallTrampoline   = "$$call"
+	ReturnTrampoline = "$$return"
+)
+
 type Command []AssemblyGenerator
 
 func (c Command) Compile() ([]AssemblyInstruction, error) {
@@ -46,18 +216,28 @@ func (c Command) Compile() ([]AssemblyInstruction, error) {
 }
 
 type VM struct {
-	file     string
+	file string
+	// name is the base name of file without its extension, used to qualify the static variables of the file.
+	name     string
 	context  string
 	lx       internal.Lexer
 	sequence int
-	statics  [240]int
+	// trampolines is set when calls and returns jump to the shared routines of Trampolines.
+	trampolines bool
+	// position is where the command most recently read by Next begins.
+	position lexer.Position
+	// functions holds every function defined by the commands read so far and calls the function name of every call.
+	functions map[string]bool
+	calls     []internal.Token
 }
 
 func (vm *VM) Next() (Command, error) {
 	token, err := vm.lx.Next()
 	if err != nil {
+		vm.position = vm.lx.Position()
 		return nil, err
 	}
+	vm.position = token.Position
 	switch token.Variant {
 	case internal.Push:
 		t, err := vm.lx.Next()
@@ -68,7 +248,7 @@ func (vm *VM) Next() (Command, error) {
 		if err != nil {
 			return nil, err
 		}
-		return vm.Push(t, i), nil
+		return vm.Push(t, i)
 	case internal.Pop:
 		t, err := vm.lx.Next()
 		if err != nil {
@@ -78,7 +258,7 @@ func (vm *VM) Next() (Command, error) {
 		if err != nil {
 			return nil, err
 		}
-		return vm.Pop(t, i), nil
+		return vm.Pop(t, i)
 	case internal.Add:
 		return vm.Add(), nil
 	case internal.Sub:
@@ -109,6 +289,12 @@ func (vm *VM) Next() (Command, error) {
 			return nil, err
 		}
 		return vm.IfGoto(l.Literal), nil
+	case internal.Label:
+		l, err := vm.lx.Expect(internal.Identifier)
+		if err != nil {
+			return nil, err
+		}
+		return vm.Label(l.Literal), nil
 	case internal.Return:
 		return vm.Return(), nil
 	case internal.Function:
@@ -121,6 +307,10 @@ func (vm *VM) Next() (Command, error) {
 			return nil, err
 		}
 		vm.context = fn.Literal
+		if vm.functions == nil {
+			vm.functions = make(map[string]bool)
+		}
+		vm.functions[fn.Literal] = true
 		return vm.Function(fn.Literal, nArgs), nil
 	case internal.Call:
 		fn, err := vm.lx.Expect(internal.Identifier)
@@ -131,12 +321,19 @@ func (vm *VM) Next() (Command, error) {
 		if err != nil {
 			return nil, err
 		}
+		vm.calls = append(vm.calls, fn)
 		return vm.Call(fn.Literal, nArgs), nil
 	default:
-		return nil, fmt.Errorf("unexpected token: %s", token.Literal)
+		return nil, lexer.TokenErrorf(token, "unexpected token: %s", token.Literal)
 	}
 }
 
+// synchronize skips the remainder of the current line. The VM language has one command per line which makes the next
+// line a safe place to resume from after a malformed command.
+func (vm *VM) synchronize() {
+	_ = vm.lx.Seek(lexer.Equals[internal.Variant]('\n'))
+}
+
 func (vm *VM) nextInteger() (int, error) {
 	i, err := vm.lx.Expect(internal.Integer)
 	if err != nil {
@@ -145,20 +342,10 @@ func (vm *VM) nextInteger() (int, error) {
 	return strconv.Atoi(i.Literal)
 }
 
-func (vm *VM) static(index int) int {
-	if vm.statics[index] > 15 {
-		// The references static has already been allocated in memory
-		return vm.statics[index]
-	}
-	// Find the next available memory address and allocate the index to it
-	current := 15
-	for _, n := range vm.statics {
-		if n > current {
-			current = n
-		}
-	}
-	vm.statics[index] = current + 1
-	return vm.statics[index]
+// static returns the assembler variable that holds the static variable index of the current file. Naming statics after
+// their file keeps the files of a program from sharing statics and leaves the allocation of addresses to the assembler.
+func (vm *VM) static(index int) string {
+	return fmt.Sprintf("%s.%d", vm.name, index)
 }
 
 func (vm *VM) Add() Command {
@@ -230,7 +417,7 @@ func (vm *VM) unary(operation AssemblyInstruction) Command {
 	}
 }
 
-func (vm *VM) Push(t internal.Token, index int) Command {
+func (vm *VM) Push(t internal.Token, index int) (Command, error) {
 	// The preload is responsible for getting the data that should be pushed to the stack to the D register
 	var preload AssemblyGenerator
 	switch t.Variant {
@@ -267,26 +454,35 @@ func (vm *VM) Push(t internal.Token, index int) Command {
 				Index: index,
 			},
 		}
+	case internal.Pointer:
+		ptr, err := pointer(t, index)
+		if err != nil {
+			return nil, err
+		}
+		preload = LoadMemoryInto{
+			Value:   ptr,
+			Targets: Target(D{}),
+		}
 	case internal.Temp:
 		preload = LoadTempInto{
 			Index:   index,
 			Targets: Target(D{}),
 		}
 	case internal.Static:
-		preload = LoadInto{
-			Value:   strconv.Itoa(vm.static(index)),
+		preload = LoadMemoryInto{
+			Value:   vm.static(index),
 			Targets: Target(D{}),
 		}
 	default:
-		panic(fmt.Errorf("push type not supported: %s", t.Literal))
+		return nil, lexer.TokenErrorf(t, "push segment not supported: %s", t.Literal)
 	}
 	return []AssemblyGenerator{
 		preload,
 		Push{},
-	}
+	}, nil
 }
 
-func (vm *VM) Pop(t internal.Token, index int) Command {
+func (vm *VM) Pop(t internal.Token, index int) (Command, error) {
 	var preload AssemblyGenerator
 	switch t.Variant {
 	case internal.Local:
@@ -297,12 +493,21 @@ func (vm *VM) Pop(t internal.Token, index int) Command {
 		preload = InlineGenerator(Load{Value: "THIS"})
 	case internal.That:
 		preload = InlineGenerator(Load{Value: "THAT"})
+	case internal.Pointer:
+		ptr, err := pointer(t, index)
+		if err != nil {
+			return nil, err
+		}
+		return vm.store(ptr), nil
 	case internal.Temp:
-		preload = InlineGenerator(Load{Value: "5"})
+		if index < 0 || index > 7 {
+			return nil, lexer.TokenErrorf(t, "invalid temp index %d", index)
+		}
+		return vm.store(strconv.Itoa(5 + index)), nil
 	case internal.Static:
-		preload = InlineGenerator(Load{Value: strconv.Itoa(vm.static(index))})
+		return vm.store(vm.static(index)), nil
 	default:
-		panic(fmt.Errorf("pop target not supported: %s", t.Literal))
+		return nil, lexer.TokenErrorf(t, "pop segment not supported: %s", t.Literal)
 	}
 	return []AssemblyGenerator{
 		Pop{},
@@ -350,13 +555,53 @@ func (vm *VM) Pop(t internal.Token, index int) Command {
 				Targets: Target(M{}),
 			},
 		),
+	}, nil
+}
+
+// store pops the top of the stack into the fixed address or symbol addr.
+func (vm *VM) store(addr string) Command {
+	return []AssemblyGenerator{
+		Pop{},
+		InlineGenerator(
+			Assign{Source: M{}, Targets: Target(D{})},
+			Load{Value: addr},
+			Assign{Source: D{}, Targets: Target(M{})},
+		),
+	}
+}
+
+// pointer returns the register that the pointer segment maps index to, pointer 0 being THIS and pointer 1 being THAT.
+func pointer(t internal.Token, index int) (string, error) {
+	switch index {
+	case 0:
+		return "THIS", nil
+	case 1:
+		return "THAT", nil
+	default:
+		return "", lexer.TokenErrorf(t, "invalid pointer index %d", index)
+	}
+}
+
+// label qualifies name with the function currently being translated since labels are scoped to functions.
+func (vm *VM) label(name string) string {
+	if vm.context == "" {
+		return name
+	}
+	return fmt.Sprintf("%s$%s", vm.context, name)
+}
+
+func (vm *VM) Label(name string) Command {
+	return []AssemblyGenerator{
+		InlineGenerator(
+			Label{Value: vm.label(name)},
+		),
 	}
 }
 
 func (vm *VM) Goto(label string) Command {
 	return []AssemblyGenerator{
 		InlineGenerator(
-			Load{Value: label},
+			Load{Value: vm.label(label)},
 			JMP{Instruction: Zero{}},
 		),
 	}
@@ -367,8 +612,8 @@ func (vm *VM) IfGoto(label string) Command {
 		Pop{},
 		InlineGenerator(
 			Assign{Source: M{}, Targets: Target(D{})},
-			Load{Value: label},
-			JGT{Instruction: D{}},
+			Load{Value: vm.label(label)},
+			JNE{Instruction: D{}},
 		),
 	}
 }
@@ -385,6 +630,8 @@ func (vm *VM) Gt() Command {
 	return vm.comparison(JGT{Instruction: D{}})
 }
 
+// comparison pushes -1 if jmp jumps on the difference of the two topmost values of the stack and 0 otherwise. Like the
+// trampolines its labels begin with a '$' so that they do not collide with the statics of a file such as T.vm.
 func (vm *VM) comparison(jmp AssemblyInstruction) Command {
 	seq := vm.seq()
 	return []AssemblyGenerator{
@@ -406,20 +653,20 @@ func (vm *VM) comparison(jmp AssemblyInstruction) Command {
 			},
 		),
 		InlineGenerator(
-			Load{Value: fmt.Sprintf("T.%d", seq)},
+			Load{Value: fmt.Sprintf("$cmp.T.%d", seq)},
 			jmp,
 			Assign{
 				Source:  Zero{},
 				Targets: Target(D{}),
 			},
-			Load{Value: fmt.Sprintf("END.%d", seq)},
+			Load{Value: fmt.Sprintf("$cmp.END.%d", seq)},
 			JMP{Instruction: Zero{}},
-			Label{Value: fmt.Sprintf("T.%d", seq)},
+			Label{Value: fmt.Sprintf("$cmp.T.%d", seq)},
 			Assign{
 				Source:  One{Negative: true},
 				Targets: Target(D{}),
 			},
-			Label{Value: fmt.Sprintf("END.%d", seq)},
+			Label{Value: fmt.Sprintf("$cmp.END.%d", seq)},
 		),
 		Push{},
 	}
@@ -433,7 +680,7 @@ func (vm *VM) seq() int {
 func (vm *VM) Function(name string, nArgs int) Command {
 	cmd := []AssemblyGenerator{
 		InlineGenerator(
-			Label{Value: fmt.Sprintf("%s.%s", vm.file, name)},
+			Label{Value: name},
 		),
 	}
 	for range nArgs {
@@ -453,6 +700,19 @@ func (vm *VM) Function(name string, nArgs int) Command {
 }
 
 func (vm *VM) Return() Command {
+	if vm.trampolines {
+		return []AssemblyGenerator{
+			InlineGenerator(
+				Load{Value: ReturnTrampoline},
+				JMP{Instruction: Zero{}},
+			),
+		}
+	}
+	return vm.ret()
+}
+
+// ret restores the frame of the caller and jumps back to it.
+func (vm *VM) ret() Command {
 	rewind := func(segment string, offset int) AssemblyGenerator {
 		return InlineGenerator(
 			Load{Value: "R13"},
@@ -466,12 +726,17 @@ func (vm *VM) Return() Command {
 					X: D{},
 					Y: A{},
 				},
-				Targets: Target(A{}, D{}),
+				Targets: Target(A{}),
 			},
 			Assign{
 				Source:  M{},
 				Targets: Target(D{}),
 			},
+			Load{Value: segment},
+			Assign{
+				Source:  D{},
+				Targets: Target(M{}),
+			},
 		)
 	}
 	return []AssemblyGenerator{
@@ -488,7 +753,11 @@ func (vm *VM) Return() Command {
 					X: D{},
 					Y: A{},
 				},
-				Targets: Target(A{}, D{}),
+				Targets: Target(A{}),
+			},
+			Assign{
+				Source:  M{},
+				Targets: Target(D{}),
 			},
 			Load{Value: "R14"},
 			Assign{
@@ -496,7 +765,7 @@ func (vm *VM) Return() Command {
 				Targets: Target(M{}),
 			},
 		),
-		// Pop stack into ARG
+		// Pop the return value into the first argument of the frame, which becomes the top of the stack of the caller
 		Pop{},
 		InlineGenerator(
 			Assign{
@@ -512,20 +781,20 @@ func (vm *VM) Return() Command {
 				Source:  D{},
 				Targets: Target(M{}),
 			},
-			Load{Value: "ARG"},
-			Assign{
-				Source:  D{},
-				Targets: Target(M{}),
-			},
 		),
 		InlineGenerator(
 			// Reposition stack pointer
-			Load{Value: StackPointer},
+			Load{Value: "ARG"},
 			Assign{
-				Source: Add[D]{
-					X: D{},
+				Source: Add[M]{
+					X: M{},
 					Y: One{},
 				},
+				Targets: Target(D{}),
+			},
+			Load{Value: StackPointer},
+			Assign{
+				Source:  D{},
 				Targets: Target(M{}),
 			},
 		),
@@ -545,7 +814,23 @@ func (vm *VM) Return() Command {
 }
 
 func (vm *VM) Call(fn string, nArgs int) Command {
-	retAddr := fmt.Sprintf("%s.%s$ret%d", vm.file, vm.context, vm.seq())
+	retAddr := fmt.Sprintf("%s$ret.%d", vm.context, vm.seq())
+	if vm.trampolines {
+		// The call trampoline finds the return address in R13, the number of arguments in R14 and the callee in R15
+		return []AssemblyGenerator{
+			LoadInto{Value: retAddr, Targets: Target(D{})},
+			InlineGenerator(Load{Value: "R13"}, Assign{Source: D{}, Targets: Target(M{})}),
+			LoadInto{Value: strconv.Itoa(nArgs), Targets: Target(D{})},
+			InlineGenerator(Load{Value: "R14"}, Assign{Source: D{}, Targets: Target(M{})}),
+			LoadInto{Value: fn, Targets: Target(D{})},
+			InlineGenerator(Load{Value: "R15"}, Assign{Source: D{}, Targets: Target(M{})}),
+			InlineGenerator(
+				Load{Value: CallTrampoline},
+				JMP{Instruction: Zero{}},
+				Label{Value: retAddr},
+			),
+		}
+	}
 	return []AssemblyGenerator{
 		LoadInto{
 			Value:   retAddr,
@@ -591,6 +876,17 @@ func (vm *VM) Call(fn string, nArgs int) Command {
 				Source:  D{},
 				Targets: Target(M{}),
 			},
+			// The frame of the callee begins at the current top of the stack
+			Load{Value: StackPointer},
+			Assign{
+				Source:  M{},
+				Targets: Target(D{}),
+			},
+			Load{Value: "LCL"},
+			Assign{
+				Source:  D{},
+				Targets: Target(M{}),
+			},
 		),
 		InlineGenerator(
 			Load{Value: fn},
@@ -599,3 +895,61 @@ func (vm *VM) Call(fn string, nArgs int) Command {
 		),
 	}
 }
+
+// Bootstrap initializes the stack pointer to 256 and calls Sys.init, which is expected to never return.
+func (vm *VM) Bootstrap() Command {
+	vm.context = "Bootstrap"
+	return append(
+		[]AssemblyGenerator{
+			LoadInto{
+				Value:   "256",
+				Targets: Target(D{}),
+			},
+			InlineGenerator(
+				Load{Value: StackPointer},
+				Assign{
+					Source:  D{},
+					Targets: Target(M{}),
+				},
+			),
+		},
+		vm.Call("Sys.init", 0)...,
+	)
+}
+
+// Trampolines generates the shared routines that calls and returns jump to when translating with trampolines. The call
+// routine expects the return address in R13, the number of arguments in R14 and the address of the callee in R15.
+func (vm *VM) Trampolines() Command {
+	cmd := []AssemblyGenerator{
+		InlineGenerator(Label{Value: CallTrampoline}),
+		LoadMemoryInto{Value: "R13", Targets: Target(D{})},
+		Push{},
+	}
+	for _, segment := range []string{"LCL", "ARG", "THIS", "THAT"} {
+		cmd = append(cmd, LoadMemoryInto{Value: segment, Targets: Target(D{})}, Push{})
+	}
+	cmd = append(
+		cmd,
+		InlineGenerator(
+			// ARG = SP - 5 - nArgs
+			Load{Value: StackPointer},
+			Assign{Source: M{}, Targets: Target(D{})},
+			Load{Value: "5"},
+			Assign{Source: Sub[D]{X: D{}, Y: A{}}, Targets: Target(D{})},
+			Load{Value: "R14"},
+			Assign{Source: Sub[D]{X: D{}, Y: M{}}, Targets: Target(D{})},
+			Load{Value: "ARG"},
+			Assign{Source: D{}, Targets: Target(M{})},
+			// LCL = SP
+			Load{Value: StackPointer},
+			Assign{Source: M{}, Targets: Target(D{})},
+			Load{Value: "LCL"},
+			Assign{Source: D{}, Targets: Target(M{})},
+			Load{Value: "R15"},
+			Assign{Source: M{}, Targets: Target(A{})},
+			JMP{Instruction: Zero{}},
+			Label{Value: ReturnTrampoline},
+		),
+	)
+	return append(cmd, vm.ret()...)
+}
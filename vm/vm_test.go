@@ -1,6 +1,15 @@
 package vm
 
 import (
+	"errors"
+	"fmt"
+	"github.com/crookdc/nand2tetris/asm"
+	"github.com/crookdc/nand2tetris/diagnostic"
+	"github.com/crookdc/nand2tetris/hackfile"
+	"github.com/crookdc/nand2tetris/lexer"
+	"github.com/crookdc/nand2tetris/simulator"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -321,15 +330,8 @@ func TestEvaluate(t *testing.T) {
 				"@SP",
 				"AM=M-1",
 				"D=M",
-				"@5",
-				"D=D+M",
-				"@3",
-				"D=D+A",
-				"@SP",
-				"A=M",
-				"A=M",
-				"A=D-A",
-				"M=D-A",
+				"@8",
+				"M=D",
 			},
 		},
 		{
@@ -339,14 +341,7 @@ func TestEvaluate(t *testing.T) {
 				"AM=M-1",
 				"D=M",
 				"@5",
-				"D=D+M",
-				"@0",
-				"D=D+A",
-				"@SP",
-				"A=M",
-				"A=M",
-				"A=D-A",
-				"M=D-A",
+				"M=D",
 			},
 		},
 		{
@@ -448,14 +443,14 @@ func TestEvaluate(t *testing.T) {
 				"@SP",
 				"AM=M-1",
 				"D=M-D",
-				"@T.1",
+				"@$cmp.T.1",
 				"D;JEQ",
 				"D=0",
-				"@END.1",
+				"@$cmp.END.1",
 				"0;JMP",
-				"(T.1)",
+				"($cmp.T.1)",
 				"D=-1",
-				"(END.1)",
+				"($cmp.END.1)",
 				"@SP",
 				"A=M",
 				"M=D",
@@ -472,14 +467,14 @@ func TestEvaluate(t *testing.T) {
 				"@SP",
 				"AM=M-1",
 				"D=M-D",
-				"@T.1",
+				"@$cmp.T.1",
 				"D;JLT",
 				"D=0",
-				"@END.1",
+				"@$cmp.END.1",
 				"0;JMP",
-				"(T.1)",
+				"($cmp.T.1)",
 				"D=-1",
-				"(END.1)",
+				"($cmp.END.1)",
 				"@SP",
 				"A=M",
 				"M=D",
@@ -496,14 +491,14 @@ func TestEvaluate(t *testing.T) {
 				"@SP",
 				"AM=M-1",
 				"D=M-D",
-				"@T.1",
+				"@$cmp.T.1",
 				"D;JGT",
 				"D=0",
-				"@END.1",
+				"@$cmp.END.1",
 				"0;JMP",
-				"(T.1)",
+				"($cmp.T.1)",
 				"D=-1",
-				"(END.1)",
+				"($cmp.END.1)",
 				"@SP",
 				"A=M",
 				"M=D",
@@ -512,9 +507,9 @@ func TestEvaluate(t *testing.T) {
 			},
 		},
 		{
-			src: "function Pow 2",
+			src: "function Main.pow 2",
 			expected: []string{
-				"(Main.Pow)",
+				"(Main.pow)",
 				// First parameter
 				"@0",
 				"D=A",
@@ -547,7 +542,49 @@ func TestEvaluate(t *testing.T) {
 				"AM=M-1",
 				"D=M",
 				"@LOOP",
-				"D;JGT",
+				"D;JNE",
+			},
+		},
+		{
+			src: "push pointer 0",
+			expected: []string{
+				"@THIS",
+				"D=M",
+				"@SP",
+				"A=M",
+				"M=D",
+				"@SP",
+				"M=M+1",
+			},
+		},
+		{
+			src: "pop pointer 1",
+			expected: []string{
+				"@SP",
+				"AM=M-1",
+				"D=M",
+				"@THAT",
+				"M=D",
+			},
+		},
+		{
+			src: "label LOOP",
+			expected: []string{
+				"(LOOP)",
+			},
+		},
+		{
+			src: "function Main.loop 0\nlabel LOOP\ngoto LOOP\nif-goto END",
+			expected: []string{
+				"(Main.loop)",
+				"(Main.loop$LOOP)",
+				"@Main.loop$LOOP",
+				"0;JMP",
+				"@SP",
+				"AM=M-1",
+				"D=M",
+				"@Main.loop$END",
+				"D;JNE",
 			},
 		},
 	}
@@ -563,3 +600,456 @@ func TestEvaluate(t *testing.T) {
 		})
 	}
 }
+
+func TestTranslate_errors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{
+			src:      "push constant 1\n7\n",
+			expected: "Main.vm:2:1: unexpected token: 7",
+		},
+		{
+			src:      "push constant 1\n\ncall Main.main",
+			expected: "Main.vm:3:15: unexpected EOF",
+		},
+		{
+			src:      "push pointer 2",
+			expected: "Main.vm:1:6: invalid pointer index 2",
+		},
+		{
+			src:      "pop constant 1",
+			expected: "Main.vm:1:5: pop segment not supported: constant",
+		},
+		{
+			src:      "push add 1",
+			expected: "Main.vm:1:6: push segment not supported: add",
+		},
+		{
+			src:      "pop temp 8",
+			expected: "Main.vm:1:5: invalid temp index 8",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			_, err := Translate("Main.vm", strings.NewReader(test.src))
+			if err == nil {
+				t.Fatal("expected an error but got nil")
+			}
+			if err.Error() != test.expected {
+				t.Errorf("expected %q but got %q", test.expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestTranslate_diagnostics(t *testing.T) {
+	src := "push constant 1\npush temp 9\nadd 3\ncall Main.main\npush constant 2\n# nonsense\nsub\n"
+	_, err := Translate("Main.vm", strings.NewReader(src))
+	var list diagnostic.List
+	if !errors.As(err, &list) {
+		t.Fatalf("expected a diagnostic list but got %v", err)
+	}
+	expected := []int{2, 3, 5, 6}
+	if len(list) != len(expected) {
+		t.Fatalf("expected %d diagnostics but got %d: %v", len(expected), len(list), list)
+	}
+	for i, line := range expected {
+		if list[i].Range.Start.Line != line {
+			t.Errorf("expected diagnostic %d on line %d but got %s", i, line, list[i])
+		}
+	}
+}
+
+func TestTranslateProgram(t *testing.T) {
+	sources := []Source{
+		{
+			Name:   "dir/Main.vm",
+			Reader: strings.NewReader("function Main.main 0\npush static 0\ncall Math.double 1\nreturn"),
+		},
+		{
+			Name:   "dir/Math.vm",
+			Reader: strings.NewReader("function Math.double 0\npush static 0\npush static 1\nreturn"),
+		},
+	}
+	actual, err := TranslateProgram(sources, Options{Bootstrap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := strings.Join(actual, "\n")
+	expected := []string{
+		"@256\nD=A\n@SP\nM=D\n@Bootstrap$ret.1\n",
+		"@Sys.init\n0;JMP\n(Bootstrap$ret.1)\n(Main.main)\n@Main.0\nD=M\n",
+		"@Math.double\n0;JMP\n(Main.main$ret.2)\n",
+		"(Math.double)\n@Math.0\nD=M\n@SP\nA=M\nM=D\n@SP\nM=M+1\n@Math.1\nD=M\n",
+	}
+	for _, fragment := range expected {
+		if !strings.Contains(program, fragment) {
+			t.Errorf("expected program to contain %q\n%s", fragment, program)
+		}
+	}
+	if !strings.HasPrefix(program, expected[0]) {
+		t.Errorf("expected program to begin with the bootstrap code")
+	}
+}
+
+func TestTranslateProgram_diagnostics(t *testing.T) {
+	sources := []Source{
+		{Name: "Main.vm", Reader: strings.NewReader("push constant 1\nnonsense\n")},
+		{Name: "Math.vm", Reader: strings.NewReader("add\npush temp 9\n")},
+	}
+	_, err := TranslateProgram(sources, Options{})
+	var list diagnostic.List
+	if !errors.As(err, &list) {
+		t.Fatalf("expected a diagnostic list but got %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected 2 diagnostics but got %d: %v", len(list), list)
+	}
+	if list[0].Range.Start.File != "Main.vm" || list[1].Range.Start.File != "Math.vm" {
+		t.Errorf("expected diagnostics in Main.vm and Math.vm but got %v", list)
+	}
+}
+
+func TestTranslateProgram_statics(t *testing.T) {
+	sources := []Source{
+		{Name: "Main.vm", Reader: strings.NewReader("push constant 1\npop static 0\npush static 0")},
+		{Name: "lib/Math.vm", Reader: strings.NewReader("push constant 2\npop static 0\npush static 1")},
+		{Name: "Main.vm", Reader: strings.NewReader("push static 0")},
+	}
+	actual, err := TranslateProgram(sources, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err := asm.Assemble(strings.Join(actual, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The program has no labels so every line of assembly corresponds to the instruction at the same index.
+	symbols := make([]string, 0)
+	addresses := make([]string, 0)
+	for i, ins := range actual {
+		if strings.HasPrefix(ins, "@Main.") || strings.HasPrefix(ins, "@Math.") {
+			symbols = append(symbols, ins)
+			addresses = append(addresses, string(program[i][:]))
+		}
+	}
+	expected := []string{"@Main.0", "@Main.0", "@Math.0", "@Math.1", "@Main.0"}
+	if !reflect.DeepEqual(symbols, expected) {
+		t.Fatalf("expected statics %v but got %v", expected, symbols)
+	}
+	if addresses[0] != addresses[1] || addresses[0] != addresses[4] {
+		t.Errorf("expected every reference to Main.0 to share an address")
+	}
+	if addresses[0] == addresses[2] || addresses[2] == addresses[3] || addresses[0] == addresses[3] {
+		t.Errorf("expected statics of different files and indices to have distinct addresses")
+	}
+}
+
+// execute assembles asm and runs it on the CPU simulator until it halts.
+func execute(t *testing.T, code []string) *simulator.Simulator {
+	program, err := asm.Assemble(strings.Join(code, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rom := make([]uint16, len(program))
+	for i, ins := range program {
+		for _, bit := range ins {
+			rom[i] = rom[i]<<1 | uint16(bit)
+		}
+	}
+	s := simulator.New(simulator.Parameters{ROM: rom})
+	if _, err := s.RunUntil(func(*simulator.Simulator) bool { return false }, 1_000_000); !errors.Is(err, simulator.ErrHalted) {
+		t.Fatalf("expected program to halt but got %v", err)
+	}
+	return s
+}
+
+const (
+	sys = `function Sys.init 0
+push constant 10
+call Main.fibonacci 1
+pop static 0
+push constant 3
+push constant 4
+call Main.mix 2
+pop static 1
+push constant 4000
+call Main.negate 1
+pop static 2
+label HALT
+goto HALT`
+	main = `function Main.fibonacci 0
+push argument 0
+push constant 2
+lt
+if-goto BASE
+push argument 0
+push constant 1
+sub
+call Main.fibonacci 1
+push argument 0
+push constant 2
+sub
+call Main.fibonacci 1
+add
+return
+label BASE
+push static 0
+push constant 1
+add
+pop static 0
+push argument 0
+return
+function Main.mix 2
+push argument 0
+push argument 1
+sub
+neg
+pop local 1
+push local 1
+push constant 0
+eq
+not
+push argument 1
+and
+push local 1
+or
+pop local 0
+push constant 3000
+pop pointer 1
+push local 0
+pop that 2
+push that 2
+push constant 1
+add
+push argument 0
+gt
+pop temp 3
+push temp 3
+push local 0
+add
+return
+function Main.negate 1
+push argument 0
+pop pointer 0
+push constant 3
+neg
+pop this 0
+push argument 0
+push constant 5
+add
+pop pointer 1
+push constant 7
+neg
+pop that 1
+push that 1
+push this 0
+add
+pop local 0
+push local 0
+neg
+pop that 2
+push local 0
+return`
+)
+
+func TestTranslateProgram_simulator(t *testing.T) {
+	sources := func() []Source {
+		return []Source{
+			{Name: "Sys.vm", Reader: strings.NewReader(sys)},
+			{Name: "Main.vm", Reader: strings.NewReader(main)},
+		}
+	}
+	program, err := Parse(sources())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reference, err := NewInterpreter(InterpreterParameters{Program: program})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reference.Continue(); err != nil {
+		t.Fatal(err)
+	}
+	// The return address saved by the bootstrap call differs by nature, the rest of the memory should be identical.
+	// Negative values are stored through this and that into the heap, which the translated pops compute addresses of
+	// using A=D-A while A holds the popped value.
+	addresses := []uint16{0, 1, 2, 3, 4, 257, 258, 259, 260, 3002}
+	for addr := uint16(16); addr < 24; addr++ {
+		addresses = append(addresses, addr)
+	}
+	for addr := uint16(4000); addr < 4010; addr++ {
+		addresses = append(addresses, addr)
+	}
+	sizes := make(map[string]int)
+	for _, opts := range []Options{{}, {Optimize: true}, {Trampolines: true}, {Optimize: true, Trampolines: true}} {
+		opts.Bootstrap = true
+		name := fmt.Sprintf("optimize=%v trampolines=%v", opts.Optimize, opts.Trampolines)
+		t.Run(name, func(t *testing.T) {
+			code, err := TranslateProgram(sources(), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sizes[name] = Count(code)
+			s := execute(t, code)
+			for _, addr := range addresses {
+				if s.Peek(addr) != reference.Peek(addr) {
+					t.Errorf("expected RAM[%d] to be %d but got %d", addr, reference.Peek(addr), s.Peek(addr))
+				}
+			}
+		})
+	}
+	if sizes["optimize=false trampolines=true"] >= sizes["optimize=false trampolines=false"] {
+		t.Errorf("expected trampolines to shrink the program but got %v", sizes)
+	}
+	if sizes["optimize=true trampolines=false"] >= sizes["optimize=false trampolines=false"] {
+		t.Errorf("expected optimizing to shrink the program but got %v", sizes)
+	}
+}
+
+func TestTranslateDebug(t *testing.T) {
+	tests := []struct {
+		label    string
+		expected asm.Origin
+	}{
+		{
+			label:    "Main.mix",
+			expected: asm.Origin{Position: lexer.Position{File: "Main.vm", Line: 23}, Function: "Main.mix", Command: "function Main.mix 2"},
+		},
+		{
+			label:    "Main.fibonacci$BASE",
+			expected: asm.Origin{Position: lexer.Position{File: "Main.vm", Line: 17}, Function: "Main.fibonacci", Command: "push static 0"},
+		},
+		{
+			label:    "Sys.init$HALT",
+			expected: asm.Origin{Position: lexer.Position{File: "Sys.vm", Line: 13}, Function: "Sys.init", Command: "goto HALT"},
+		},
+	}
+	for _, opts := range []Options{{}, {Optimize: true}, {Trampolines: true}, {Optimize: true, Trampolines: true}} {
+		opts.Bootstrap = true
+		t.Run(fmt.Sprintf("optimize=%v trampolines=%v", opts.Optimize, opts.Trampolines), func(t *testing.T) {
+			code, origins, err := TranslateDebug([]Source{
+				{Name: "Sys.vm", Reader: strings.NewReader(sys)},
+				{Name: "Main.vm", Reader: strings.NewReader(main)},
+			}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			program, debug, err := asm.AssembleGenerated("", code, origins)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(debug.Origins) != len(program) {
+				t.Fatalf("expected %d origins but got %d", len(program), len(debug.Origins))
+			}
+			if origin := debug.Origins[0]; origin.Function != "Bootstrap" || origin.Command != "bootstrap" {
+				t.Errorf("expected the first instruction to originate from the bootstrap code but got %v", origin)
+			}
+			for _, test := range tests {
+				origin := debug.Origins[debug.Labels[test.label]]
+				origin.Position = lexer.Position{File: origin.Position.File, Line: origin.Position.Line}
+				if !reflect.DeepEqual(origin, test.expected) {
+					t.Errorf("expected %s to originate from %v but got %v", test.label, test.expected, origin)
+				}
+			}
+		})
+	}
+}
+
+func TestTranslateDebug_profile(t *testing.T) {
+	for _, opts := range []Options{{}, {Optimize: true}, {Trampolines: true}, {Optimize: true, Trampolines: true}} {
+		opts.Bootstrap = true
+		t.Run(fmt.Sprintf("optimize=%v trampolines=%v", opts.Optimize, opts.Trampolines), func(t *testing.T) {
+			code, origins, err := TranslateDebug([]Source{
+				{Name: "Sys.vm", Reader: strings.NewReader(sys)},
+				{Name: "Main.vm", Reader: strings.NewReader(main)},
+			}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			program, debug, err := asm.AssembleGenerated("Main.asm", code, origins)
+			if err != nil {
+				t.Fatal(err)
+			}
+			profiler := simulator.NewProfiler(debug)
+			s := simulator.New(simulator.Parameters{ROM: hackfile.Words(program), Tracer: profiler})
+			if _, err := s.RunUntil(func(*simulator.Simulator) bool { return false }, 1_000_000); !errors.Is(err, simulator.ErrHalted) {
+				t.Fatalf("expected program to halt but got %v", err)
+			}
+			var sb strings.Builder
+			if err := profiler.WriteCallGraph(&sb); err != nil {
+				t.Fatal(err)
+			}
+			// Fibonacci of 10 makes 177 calls, all but the first of which are recursive.
+			for _, expected := range []string{
+				"\nBootstrap  total " + fmt.Sprint(s.Cycles()) + " (100.00%)",
+				"    calls Sys.init 1 times,",
+				"    calls Main.fibonacci 1 times,",
+				"    calls Main.fibonacci 176 times,",
+				"    calls Main.mix 1 times,",
+				"    called by Main.fibonacci 176 times\n",
+			} {
+				if !strings.Contains(sb.String(), expected) {
+					t.Errorf("expected call graph to contain %q but got\n%s", expected, sb.String())
+				}
+			}
+		})
+	}
+}
+
+func TestReadSources(t *testing.T) {
+	dir := t.TempDir()
+	for name, src := range map[string]string{"Main.vm": main, "Sys.vm": sys, "notes.txt": "not vm code"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "nested.vm"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	sources, err := ReadSources(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(sources))
+	for i, src := range sources {
+		names[i] = filepath.Base(src.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Main.vm", "Sys.vm"}) {
+		t.Errorf("expected the VM files of the directory but got %v", names)
+	}
+	sources, err = ReadSources(filepath.Join(dir, "Sys.vm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 1 || sources[0].Name != filepath.Join(dir, "Sys.vm") {
+		t.Errorf("expected the single file but got %v", sources)
+	}
+}
+
+func TestTranslateProgram_complete(t *testing.T) {
+	src := "function Main.main 0\ncall Output.printInt 1\ncall Main.main 0\nreturn"
+	opts := Options{Bootstrap: true, Complete: true}
+	_, err := TranslateProgram([]Source{{Name: "Main.vm", Reader: strings.NewReader(src)}}, opts)
+	var list diagnostic.List
+	if !errors.As(err, &list) {
+		t.Fatalf("expected a diagnostic list but got %v", err)
+	}
+	expected := []string{
+		"the bootstrap code calls Sys.init, which is not defined",
+		"Main.vm:2:6: call to undefined function Output.printInt",
+	}
+	if len(list) != len(expected) {
+		t.Fatalf("expected %d diagnostics but got %d: %v", len(expected), len(list), list)
+	}
+	for i := range expected {
+		if list[i].Error() != expected[i] {
+			t.Errorf("expected %q but got %q", expected[i], list[i].Error())
+		}
+	}
+	if _, err := TranslateProgram([]Source{{Name: "Main.vm", Reader: strings.NewReader(src)}}, Options{}); err != nil {
+		t.Errorf("expected undefined functions to be allowed unless the program is complete but got %v", err)
+	}
+}